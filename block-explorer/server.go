@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	pb "github.com/fr13n8/go-blockchain/gen/node"
+	"github.com/fr13n8/go-blockchain/transaction"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
@@ -174,7 +175,17 @@ func (s *Server) GetBlockByHash(c *fiber.Ctx) error {
 		})
 	}
 
-	d, err := json.Marshal(getBlockByHashResponse)
+	transactions := make([]transactionView, 0, len(getBlockByHashResponse.GetTransactions()))
+	for _, tx := range getBlockByHashResponse.GetTransactions() {
+		transactions = append(transactions, newTransactionView(tx))
+	}
+	d, err := json.Marshal(struct {
+		Header       *pb.Header        `json:"header"`
+		Transactions []transactionView `json:"transactions"`
+	}{
+		Header:       getBlockByHashResponse.GetHeader(),
+		Transactions: transactions,
+	})
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -194,7 +205,7 @@ func (s *Server) GetTransactionByHash(c *fiber.Ctx) error {
 			"error": err.Error(),
 		})
 	}
-	m, err := json.Marshal(getTransactionByHashResponse)
+	m, err := json.Marshal(newTransactionView(getTransactionByHashResponse))
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": err.Error(),
@@ -202,3 +213,42 @@ func (s *Server) GetTransactionByHash(c *fiber.Ctx) error {
 	}
 	return c.SendString(string(m[:]))
 }
+
+// transactionView is the explorer representation of a transaction, with
+// amounts formatted in coins rather than base units. The amount of a UTXO
+// transaction is the total of its outputs.
+type transactionView struct {
+	Id               string                  `json:"id"`
+	SenderAddress    string                  `json:"sender_address"`
+	RecipientAddress string                  `json:"recipient_address"`
+	Amount           string                  `json:"amount"`
+	Fee              string                  `json:"fee"`
+	Inputs           []*pb.TransactionInput  `json:"inputs,omitempty"`
+	Outputs          []transactionOutputView `json:"outputs,omitempty"`
+}
+
+type transactionOutputView struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+}
+
+func newTransactionView(tx *pb.TransactionResponse) transactionView {
+	amount := transaction.Amount(tx.GetAmount())
+	outputs := make([]transactionOutputView, 0, len(tx.GetOutputs()))
+	for _, out := range tx.GetOutputs() {
+		amount += transaction.Amount(out.GetAmount())
+		outputs = append(outputs, transactionOutputView{
+			Address: out.GetAddress(),
+			Amount:  transaction.Amount(out.GetAmount()).String(),
+		})
+	}
+	return transactionView{
+		Id:               tx.GetId(),
+		SenderAddress:    tx.GetSenderAddress(),
+		RecipientAddress: tx.GetRecipientAddress(),
+		Amount:           amount.String(),
+		Fee:              transaction.Amount(tx.GetFee()).String(),
+		Inputs:           tx.GetInputs(),
+		Outputs:          outputs,
+	}
+}
@@ -0,0 +1,105 @@
+package block
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/fr13n8/go-blockchain/codec"
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+// HEADER_SIZE is the size of an encoded header in bytes.
+const HEADER_SIZE = 1 + 32 + 32 + 8 + 4 + 8
+
+// MarshalBinary returns the canonical encoding of the header. The cached
+// hash is not encoded.
+func (h *Header) MarshalBinary() ([]byte, error) {
+	w := codec.NewWriter()
+	h.encode(w)
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a header written by MarshalBinary and sets its
+// hash.
+func (h *Header) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(data)
+	h.decode(r)
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("decode header: %w", err)
+	}
+	h.Hash = h.ComputeHash()
+	return nil
+}
+
+// ComputeHash returns the block hash, the double SHA-256 of the encoded
+// header.
+func (h *Header) ComputeHash() [32]byte {
+	w := codec.NewWriter()
+	h.encode(w)
+	first := sha256.Sum256(w.Bytes())
+	return sha256.Sum256(first[:])
+}
+
+func (h *Header) encode(w *codec.Writer) {
+	var merkleRoot [32]byte
+	copy(merkleRoot[:], h.MerkleRootHash)
+
+	w.Version()
+	w.Fixed(h.PreviousHash[:])
+	w.Fixed(merkleRoot[:])
+	w.Int64(h.Timestamp)
+	w.Uint32(h.Target)
+	w.Uint64(h.Nonce)
+}
+
+func (h *Header) decode(r *codec.Reader) {
+	r.Version()
+	copy(h.PreviousHash[:], r.Fixed(32))
+	h.MerkleRootHash = append([]byte(nil), r.Fixed(32)...)
+	h.Timestamp = r.Int64()
+	h.Target = r.Uint32()
+	h.Nonce = r.Uint64()
+}
+
+// MarshalBinary returns the canonical encoding of the block: the header
+// followed by the length-prefixed encoding of every transaction.
+func (b *Block) MarshalBinary() ([]byte, error) {
+	w := codec.NewWriter()
+	b.Header.encode(w)
+	w.Uvarint(uint64(len(b.Transactions)))
+	for _, t := range b.Transactions {
+		data, err := t.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("transaction %s: %w", t.HexHash(), err)
+		}
+		w.VarBytes(data)
+	}
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a block written by MarshalBinary and sets the hash
+// of the block and the id of every transaction.
+func (b *Block) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(data)
+	var h Header
+	h.decode(r)
+	transactions := make([]*transaction.Transaction, r.Len(1))
+	for i := range transactions {
+		t := &transaction.Transaction{}
+		txData := r.VarBytes()
+		if r.Err() != nil {
+			break
+		}
+		if err := t.UnmarshalBinary(txData); err != nil {
+			return fmt.Errorf("decode block: transaction %d: %w", i, err)
+		}
+		transactions[i] = t
+	}
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("decode block: %w", err)
+	}
+	h.Hash = h.ComputeHash()
+	b.Header = h
+	b.Transactions = transactions
+	return nil
+}
@@ -0,0 +1,68 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+func testBlock(n int) *Block {
+	txs := make([]*transaction.Transaction, n)
+	for i := range txs {
+		txs[i] = transaction.NewTransaction("sender", "recipient", transaction.Amount(i+1))
+		txs[i].Id, _ = txs[i].Hash()
+	}
+	return New(42, [32]byte{1, 2, 3}, 0x1f00ffff, txs)
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	h := testBlock(2).Header
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != HEADER_SIZE {
+		t.Fatalf("header is %d bytes, want %d", len(data), HEADER_SIZE)
+	}
+	var decoded Header
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash != h.ComputeHash() {
+		t.Fatalf("decoded hash %x, want %x", decoded.Hash, h.ComputeHash())
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("UnmarshalBinary of a truncated header succeeded")
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 5} {
+		b := testBlock(n)
+		data, err := b.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Block
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%d transactions: %v", n, err)
+		}
+		again, err := decoded.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, again) {
+			t.Fatalf("%d transactions: encoding changed after a round trip", n)
+		}
+		if decoded.Hash() != b.Hash() {
+			t.Fatalf("%d transactions: decoded hash %x, want %x", n, decoded.Hash(), b.Hash())
+		}
+		if len(decoded.Transactions) != n || !decoded.VerifyMerkleRoot() {
+			t.Fatalf("%d transactions: decoded %d transactions that do not match the merkle root", n, len(decoded.Transactions))
+		}
+		if err := decoded.UnmarshalBinary(append(data, 0)); err == nil {
+			t.Fatalf("%d transactions: UnmarshalBinary with trailing data succeeded", n)
+		}
+	}
+}
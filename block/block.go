@@ -1,7 +1,7 @@
 package block
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/fr13n8/go-blockchain/transaction"
@@ -20,7 +20,7 @@ type Header struct {
 	MerkleRootHash []byte
 	Timestamp      int64
 	Nonce          uint64
-	Target         []byte
+	Target         uint32
 	Hash           [32]byte
 }
 
@@ -36,15 +36,16 @@ func (h *Header) MarshalJSON() ([]byte, error) {
 		MerkleRootHash: h.MerkleRootHash,
 		Timestamp:      h.Timestamp,
 		Nonce:          h.Nonce,
-		Target:         fmt.Sprintf("%x", h.Target),
+		Target:         fmt.Sprintf("%08x", h.Target),
 	})
 }
 
-func New(nonce uint64, previousHash [32]byte, transactions []*transaction.Transaction) *Block {
+func New(nonce uint64, previousHash [32]byte, target uint32, transactions []*transaction.Transaction) *Block {
 	return &Block{
 		Header: Header{
 			Nonce:          nonce,
 			PreviousHash:   previousHash,
+			Target:         target,
 			Timestamp:      time.Now().UnixNano(),
 			MerkleRootHash: merkleRootHash(transactions),
 		},
@@ -52,8 +53,12 @@ func New(nonce uint64, previousHash [32]byte, transactions []*transaction.Transa
 	}
 }
 
-func NewGenesisBlock(transactions []*transaction.Transaction) *Block {
-	return New(0, [32]byte{}, transactions)
+// NewGenesisBlock creates a genesis block. Unlike New it takes the timestamp,
+// so that every node builds the same block.
+func NewGenesisBlock(timestamp int64, target uint32, transactions []*transaction.Transaction) *Block {
+	b := New(0, [32]byte{}, target, transactions)
+	b.Timestamp = timestamp
+	return b
 }
 
 func (b *Block) Print() {
@@ -75,12 +80,22 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 	})
 }
 
-func (b *Block) Hash() [32]byte {
-	m, err := b.MarshalJSON()
+// Size returns the encoded size of the block in bytes.
+func (b *Block) Size() int {
+	m, err := b.MarshalBinary()
 	if err != nil {
-		log.Fatal(err)
+		panic(err)
 	}
-	return sha256.Sum256(m)
+	return len(m)
+}
+
+// VerifyMerkleRoot reports whether the header commits to the block transactions.
+func (b *Block) VerifyMerkleRoot() bool {
+	return bytes.Equal(b.Header.MerkleRootHash, merkleRootHash(b.Transactions))
+}
+
+func (b *Block) Hash() [32]byte {
+	return b.Header.ComputeHash()
 }
 
 func (b *Block) HexHash() string {
@@ -91,19 +106,52 @@ func (b *Block) HexHashPrevBlock() string {
 	return fmt.Sprintf("%x", b.Header.PreviousHash)
 }
 
-func merkleRootHash(transactions []*transaction.Transaction) []byte {
-	var txHashes [][]byte
+// TransactionProof returns the merkle proof that the transaction at index is
+// part of the block.
+func (b *Block) TransactionProof(index int) (*utils.MerkleProof, error) {
+	leaves, err := merkleLeaves(b.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewMerkleProof(leaves, index)
+}
 
-	for _, tx := range transactions {
-		tm, err := tx.MarshalJSON()
-		if err != nil {
-			log.Fatal(err)
-		}
-		txHashes = append(txHashes, tm)
+// VerifyTransactionProof checks that proof shows t to be part of the block
+// with the given header. It only needs the header, so a client can verify a
+// transaction against a header it trusts without the rest of the block.
+func VerifyTransactionProof(header *Header, t *transaction.Transaction, proof *utils.MerkleProof) error {
+	leaf, err := t.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encode transaction: %w", err)
+	}
+	if !utils.VerifyMerkleProof(header.MerkleRootHash, leaf, proof) {
+		return fmt.Errorf("transaction %s is not part of block %x", t.HexHash(), header.ComputeHash())
+	}
+	return nil
+}
+
+// merkleRootHash returns the root of the merkle tree over the encoded
+// transactions, or 32 zero bytes if there are none.
+func merkleRootHash(transactions []*transaction.Transaction) []byte {
+	txHashes, err := merkleLeaves(transactions)
+	if err != nil {
+		log.Fatal(err)
 	}
 	tree := utils.NewMerkleTree(txHashes)
 	if tree == nil {
-		return []byte{}
+		return make([]byte, 32)
 	}
 	return tree.RootNode.Data
 }
+
+func merkleLeaves(transactions []*transaction.Transaction) ([][]byte, error) {
+	var leaves [][]byte
+	for _, tx := range transactions {
+		tm, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, tm)
+	}
+	return leaves, nil
+}
@@ -0,0 +1,23 @@
+package block
+
+import "testing"
+
+func TestTransactionProof(t *testing.T) {
+	b := testBlock(5)
+	for i, tx := range b.Transactions {
+		proof, err := b.TransactionProof(i)
+		if err != nil {
+			t.Fatalf("proof of transaction %d: %v", i, err)
+		}
+		if err := VerifyTransactionProof(&b.Header, tx, proof); err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+		other := b.Transactions[(i+1)%len(b.Transactions)]
+		if err := VerifyTransactionProof(&b.Header, other, proof); err == nil {
+			t.Fatalf("proof of transaction %d verifies another transaction", i)
+		}
+	}
+	if _, err := b.TransactionProof(len(b.Transactions)); err == nil {
+		t.Fatal("proof of a transaction past the end succeeded")
+	}
+}
@@ -0,0 +1,46 @@
+package block
+
+import "math/big"
+
+// CompactToBig expands a compact target, a 32 bit number whose high byte is a
+// base-256 exponent and whose low 3 bytes are the mantissa. Targets are never
+// negative, so a set sign bit yields a zero target that no hash can satisfy.
+func CompactToBig(compact uint32) *big.Int {
+	if compact&0x00800000 != 0 {
+		return new(big.Int)
+	}
+	mantissa := compact & 0x007fffff
+	exponent := uint(compact >> 24)
+
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		return big.NewInt(int64(mantissa))
+	}
+	n := big.NewInt(int64(mantissa))
+	return n.Lsh(n, 8*(exponent-3))
+}
+
+// BigToCompact encodes a target in compact form, dropping all but its three
+// most significant bytes.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Uint64())
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		t := new(big.Int).Rsh(n, 8*(exponent-3))
+		mantissa = uint32(t.Uint64())
+	}
+
+	// the mantissa is signed, so move a set high bit into the exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	return uint32(exponent<<24) | mantissa
+}
@@ -0,0 +1,62 @@
+package block
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		want    string
+	}{
+		{0x00000000, "0"},
+		{0x01003456, "0"},
+		{0x01123456, "12"},
+		{0x02123456, "1234"},
+		{0x03123456, "123456"},
+		{0x04123456, "12345600"},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+		{0x1f00ffff, "ffff00000000000000000000000000000000000000000000000000000000"},
+		// a set sign bit is a negative target, which is treated as zero
+		{0x04923456, "0"},
+	}
+	for _, tt := range tests {
+		want, _ := new(big.Int).SetString(tt.want, 16)
+		if got := CompactToBig(tt.compact); got.Cmp(want) != 0 {
+			t.Errorf("CompactToBig(%08x) = %x, want %x", tt.compact, got, want)
+		}
+	}
+}
+
+func TestBigToCompact(t *testing.T) {
+	tests := []struct {
+		n    string
+		want uint32
+	}{
+		{"0", 0},
+		{"12", 0x01120000},
+		{"80", 0x02008000},
+		{"1234", 0x02123400},
+		{"123456", 0x03123456},
+		{"12345678", 0x04123456},
+		{"ffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+	}
+	for _, tt := range tests {
+		n, _ := new(big.Int).SetString(tt.n, 16)
+		if got := BigToCompact(n); got != tt.want {
+			t.Errorf("BigToCompact(%s) = %08x, want %08x", tt.n, got, tt.want)
+		}
+	}
+	if got := BigToCompact(big.NewInt(-1)); got != 0 {
+		t.Errorf("BigToCompact(-1) = %08x, want 0", got)
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, compact := range []uint32{0x01120000, 0x03123456, 0x1d00ffff, 0x1f00ffff, 0x2000ffff, 0x207fffff} {
+		if got := BigToCompact(CompactToBig(compact)); got != compact {
+			t.Errorf("BigToCompact(CompactToBig(%08x)) = %08x", compact, got)
+		}
+	}
+}
@@ -1,9 +1,7 @@
 package block
 
 import (
-	"encoding/hex"
 	"github.com/fr13n8/go-blockchain/utils"
-	"math/big"
 )
 
 type Solver interface {
@@ -12,29 +10,25 @@ type Solver interface {
 }
 
 const (
-	MAX_NONCE         = ^uint64(0) // 2^32 - 1
-	MINING_DIFFICULTY = "000000FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"
+	MAX_NONCE = ^uint64(0) // 2^64 - 1
 )
 
-type SHA256Solver struct {
-	difficulty *big.Int
-}
+// SHA256Solver searches for a nonce that brings the block hash under the
+// target encoded in the block header.
+type SHA256Solver struct{}
 
 func NewSHA256Solver() Solver {
-	targetBytes, _ := hex.DecodeString(MINING_DIFFICULTY)
-	targetInt := new(big.Int).SetBytes(targetBytes)
-
-	return &SHA256Solver{difficulty: targetInt}
+	return &SHA256Solver{}
 }
 
 func (s *SHA256Solver) Solve(b *Block) bool {
+	target := CompactToBig(b.Header.Target)
 	for i := uint64(0); i <= MAX_NONCE; i++ {
 		b.Header.Nonce = i
 		hash := b.Hash()
 		hashInt := utils.HashToBig(&hash)
 
-		if hashInt.Cmp(s.difficulty) <= 0 {
-			b.Header.Target = s.difficulty.Bytes()
+		if hashInt.Cmp(target) <= 0 {
 			b.Header.Hash = hash
 			return true
 		}
@@ -46,5 +40,5 @@ func (s *SHA256Solver) Solve(b *Block) bool {
 func (s *SHA256Solver) Verify(b Block) bool {
 	hash := b.Hash()
 	hashInt := utils.HashToBig(&hash)
-	return hashInt.Cmp(s.difficulty) <= 0
+	return hashInt.Cmp(CompactToBig(b.Header.Target)) <= 0
 }
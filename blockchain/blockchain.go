@@ -1,9 +1,6 @@
 package blockchain
 
 import (
-	"bytes"
-	"crypto/ecdsa"
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -14,42 +11,128 @@ import (
 	"github.com/fr13n8/go-blockchain/transaction"
 
 	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/storage"
 	"github.com/fr13n8/go-blockchain/trxpool"
-	"github.com/fr13n8/go-blockchain/utils"
 )
 
 const (
 	MINING_SENDER = "THE BLOCKCHAIN"
+	MINING_REWARD = transaction.COIN
+	// MAX_HEADERS is the most headers returned for a single request.
+	MAX_HEADERS = 2000
+	// LOCATOR_DENSE is the number of most recent blocks that are all part of
+	// a block locator before it starts skipping exponentially.
+	LOCATOR_DENSE = 10
 )
 
+// Config holds the parameters of a chain. They cannot be changed once the
+// chain has been created.
+type Config struct {
+	// Genesis specifies the genesis block and the chain id of the network.
+	// Transactions are signed for one chain id and rejected by every other.
+	Genesis *Genesis
+	// Ledger is the ledger model of the chain, LEDGER_ACCOUNT or LEDGER_UTXO.
+	Ledger string
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Genesis: DefaultGenesis(),
+		Ledger:  LEDGER_ACCOUNT,
+	}
+}
+
 type BlockChain struct {
 	TransactionPool *trxpool.TransactionPool
-	chain           []*block.Block
-	mux             sync.Mutex
+	// chain is the active chain, indexed by height.
+	chain []*blockNode
+	// nodes holds every known block, including side branches, by hash.
+	nodes   map[[32]byte]*blockNode
+	txIndex map[[32]byte]TxLocation
+	// addrIndex holds the ids of the active chain transactions of every
+	// address.
+	addrIndex map[string][][32]byte
+	chainId   string
+	// genesis is the genesis block given by the configuration.
+	genesis *block.Block
+	ledger  Ledger
+	tip     *blockNode
+	store   storage.Store
+	solver  block.Solver
+	mux     sync.Mutex
+
+	subscribers []func(*ChainUpdate)
+	notifyMux   sync.Mutex
 }
 
-func NewBlockChain() *BlockChain {
-	b := block.NewGenesisBlock([]*transaction.Transaction{})
+func NewBlockChain(cfg *Config, store storage.Store, solver block.Solver) (*BlockChain, error) {
+	ledger, err := newLedger(cfg.Ledger)
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := cfg.Genesis.Block()
+	if err != nil {
+		return nil, fmt.Errorf("genesis: %w", err)
+	}
 	trxPoll := trxpool.NewTransactionPool()
 	bc := &BlockChain{
 		TransactionPool: trxPoll,
-		chain:           []*block.Block{},
+		chain:           []*blockNode{},
+		nodes:           make(map[[32]byte]*blockNode),
+		txIndex:         make(map[[32]byte]TxLocation),
+		addrIndex:       make(map[string][][32]byte),
+		chainId:         cfg.Genesis.ChainId,
+		genesis:         genesis,
+		ledger:          ledger,
+		store:           store,
+		solver:          solver,
 	}
 
-	bc.CreateBlock(b)
-	return bc
+	if err := bc.checkChainParams(); err != nil {
+		return nil, err
+	}
+	if err := bc.loadChain(); err != nil {
+		return nil, fmt.Errorf("load chain: %w", err)
+	}
+	if bc.tip != nil {
+		log.Printf("[BLOCKCHAIN] Loaded %d blocks, tip %s at height %d, %s ledger\n", len(bc.nodes), bc.LastBlock().HexHash(), bc.tip.height, bc.ledger.Model())
+		return bc, nil
+	}
+
+	if err := bc.CreateBlock(genesis); err != nil {
+		return nil, fmt.Errorf("create genesis block: %w", err)
+	}
+	log.Printf("[BLOCKCHAIN] Created genesis block %s of chain %s, %s ledger\n", genesis.HexHash(), bc.chainId, bc.ledger.Model())
+	return bc, nil
+}
+
+func (bc *BlockChain) Close() error {
+	return bc.store.Close()
 }
 
 func (bc *BlockChain) GetBlocks() []*block.Block {
-	return bc.chain
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	blocks := make([]*block.Block, 0, len(bc.chain))
+	for _, n := range bc.chain {
+		blocks = append(blocks, n.block)
+	}
+	return blocks
 }
 
-func (bc *BlockChain) ReadTransactionsPool() []*transaction.Transaction {
-	return bc.TransactionPool.Read(10)
+// GetBlockHashes returns the hashes of the active chain in height order.
+func (bc *BlockChain) GetBlockHashes() [][32]byte {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	hashes := make([][32]byte, 0, len(bc.chain))
+	for _, n := range bc.chain {
+		hashes = append(hashes, n.hash)
+	}
+	return hashes
 }
 
-func (bc *BlockChain) GetTransactionPool() []*transaction.Transaction {
-	return bc.TransactionPool.GetAndClean(10)
+func (bc *BlockChain) ReadTransactionsPool() []*transaction.Transaction {
+	return bc.TransactionPool.Read(bc.TransactionPool.Size())
 }
 
 func (bc *BlockChain) GetBlockByHash(hash string) (*block.Block, error) {
@@ -58,115 +141,235 @@ func (bc *BlockChain) GetBlockByHash(hash string) (*block.Block, error) {
 		log.Printf("ERROR: %s\n", err)
 		return nil, err
 	}
+	var blockHash [32]byte
+	copy(blockHash[:], blockHashBytes)
+	return bc.GetBlock(blockHash)
+}
 
-	for _, b := range bc.chain {
-		blockHash := b.Hash()
-		if bytes.Equal(blockHash[:], blockHashBytes) {
-			return b, nil
-		}
+// GetBlock returns a known block, which may be on a side branch.
+func (bc *BlockChain) GetBlock(hash [32]byte) (*block.Block, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	n, ok := bc.nodes[hash]
+	if !ok {
+		return nil, fmt.Errorf("block with hash %x not found", hash)
+	}
+	return n.block, nil
+}
+
+func (bc *BlockChain) GetBlockByHeight(height int) (*block.Block, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	b := bc.blockByHeight(height)
+	if b == nil {
+		return nil, fmt.Errorf("block at height %d not found", height)
 	}
-	return nil, fmt.Errorf("block with hash %s not found", hash)
+	return b, nil
+}
+
+// ChainId returns the id of the network the chain belongs to.
+func (bc *BlockChain) ChainId() string {
+	return bc.chainId
+}
+
+// GenesisHash returns the hash of the genesis block.
+func (bc *BlockChain) GenesisHash() [32]byte {
+	return bc.genesis.Hash()
+}
+
+// LedgerModel returns the ledger model of the chain.
+func (bc *BlockChain) LedgerModel() string {
+	return bc.ledger.Model()
+}
+
+// Height returns the height of the active chain tip.
+func (bc *BlockChain) Height() int {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.tip.height
 }
 
 func (bc *BlockChain) GetTransactionByHash(hash string) (*transaction.Transaction, error) {
-	var tx *transaction.Transaction
-	for _, b := range bc.chain {
-		for _, t := range b.Transactions {
-			if t.HexHash() == hash {
-				tx = t
-			}
-		}
+	tx, _, err := bc.GetTransactionLocation(hash)
+	return tx, err
+}
+
+// GetTransactionLocation returns a transaction of the active chain together
+// with the block and position it was included at.
+func (bc *BlockChain) GetTransactionLocation(hash string) (*transaction.Transaction, TxLocation, error) {
+	txHashBytes, err := hex.DecodeString(hash)
+	if err != nil || len(txHashBytes) != 32 {
+		return nil, TxLocation{}, fmt.Errorf("invalid transaction hash %s", hash)
 	}
-	if tx == nil {
-		return nil, fmt.Errorf("transaction with hash %s not found", hash)
+	var txHash [32]byte
+	copy(txHash[:], txHashBytes)
+
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	loc, ok := bc.txIndex[txHash]
+	if !ok {
+		return nil, TxLocation{}, fmt.Errorf("transaction with hash %s not found", hash)
 	}
-	return tx, nil
+	return bc.chain[loc.Height].block.Transactions[loc.Index], loc, nil
 }
 
 func (bc *BlockChain) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Blocks []*block.Block `json:"chains"`
 	}{
-		Blocks: bc.chain,
+		Blocks: bc.GetBlocks(),
 	})
 }
 
-func (bc *BlockChain) CreateBlock(b *block.Block) *block.Block {
-	bc.chain = append(bc.chain, b)
-	return b
+// CreateBlock validates b and adds it to the block tree. If the branch it
+// extends has more cumulative work than the active chain, the chain is
+// reorganized onto that branch and subscribers are notified. A block that
+// breaks the consensus rules is rejected with a *BlockError.
+func (bc *BlockChain) CreateBlock(b *block.Block) error {
+	bc.mux.Lock()
+	update, err := bc.addBlock(b)
+	if err != nil {
+		bc.mux.Unlock()
+		return err
+	}
+	bc.notifyMux.Lock()
+	bc.mux.Unlock()
+	if update != nil {
+		bc.notify(update)
+	}
+	bc.notifyMux.Unlock()
+	return nil
+}
+
+func (bc *BlockChain) addBlock(b *block.Block) (*ChainUpdate, error) {
+	hash := b.Hash()
+	if _, ok := bc.nodes[hash]; ok {
+		return nil, rejectBlock(b, REJECT_DUPLICATE, "block already known")
+	}
+
+	var parent *blockNode
+	if len(bc.nodes) > 0 {
+		var ok bool
+		parent, ok = bc.nodes[b.PreviousHash]
+		if !ok {
+			return nil, rejectBlock(b, REJECT_ORPHAN, "unknown parent %x", b.PreviousHash)
+		}
+		if parent.invalid {
+			return nil, rejectBlock(b, REJECT_INVALID_CHAIN, "parent %x is invalid", b.PreviousHash)
+		}
+	}
+	if err := bc.validateBlock(b, parent); err != nil {
+		return nil, err
+	}
+
+	n := newBlockNode(b, parent)
+	if bc.tip != nil && n.work.Cmp(bc.tip.work) <= 0 {
+		if err := bc.storeBlock(b, false); err != nil {
+			return nil, err
+		}
+		bc.nodes[hash] = n
+		log.Printf("[BLOCKCHAIN] Block %x at height %d extends a side branch\n", hash, n.height)
+		return nil, nil
+	}
+	bc.nodes[hash] = n
+	if bc.tip != nil && b.PreviousHash != bc.tip.hash {
+		log.Printf("[BLOCKCHAIN] Reorganizing to block %x at height %d\n", hash, n.height)
+	}
+	return bc.reorganize(n)
 }
 
 func (bc *BlockChain) LastBlock() *block.Block {
-	return bc.chain[len(bc.chain)-1]
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.tip.block
+}
+
+// NewCoinbaseTransaction creates the coinbase of a block at the given height
+// that collects the block reward and the fees of the block. Its single null
+// input commits to the height, which keeps coinbase ids of the same miner
+// unique.
+func NewCoinbaseTransaction(minerAddress string, height int, fees transaction.Amount) *transaction.Transaction {
+	t := transaction.NewTransaction(MINING_SENDER, minerAddress, MINING_REWARD+fees)
+	t.Inputs = []transaction.Input{{Index: uint32(height)}}
+	id, err := t.SigningHash()
+	if err != nil {
+		panic(err)
+	}
+	t.Id = id
+	return t
 }
 
 func (bc *BlockChain) Print() {
-	for i, b := range bc.chain {
+	for i, b := range bc.GetBlocks() {
 		fmt.Printf("%s Block: %d %s\n", strings.Repeat("=", 25), i, strings.Repeat("=", 25))
 		b.Print()
 	}
 	fmt.Printf("%s\n", strings.Repeat("*", 25))
 }
 
-func (bc *BlockChain) CreateTransaction(senderAddress, recipientAddress string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+func (bc *BlockChain) CreateTransaction(t *transaction.Transaction) bool {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
-	isTransactionAdded := bc.AddTransaction(senderAddress, recipientAddress, value, senderPublicKey, s)
+	isTransactionAdded := bc.AddTransaction(t)
 	return isTransactionAdded
 }
 
-func (bc *BlockChain) AddTransaction(senderAddress, recipientAddress string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	t := transaction.NewTransaction(senderAddress, recipientAddress, value)
-
-	if senderAddress == MINING_SENDER {
-		bc.TransactionPool.Add(t)
-		return true
+// CheckTransaction verifies the parts of a transaction that do not depend on
+// the ledger, such as its signature. A transaction that fails them is invalid
+// whenever it is sent.
+func (bc *BlockChain) CheckTransaction(t *transaction.Transaction) error {
+	if t.SenderAddress == MINING_SENDER {
+		return fmt.Errorf("transactions from %s can only be created by miners", MINING_SENDER)
 	}
+	return bc.validateTransaction(t)
+}
 
-	if bc.VerifyTransactionSignature(senderPublicKey, s, t) {
-		//if bc.Balance(senderAddress) < value {
-		//	log.Printf("ERROR: Not enough balance in wallet")
-		//	return false
-		//}
-		bc.TransactionPool.Add(t)
-		return true
+// AddTransaction verifies and pools a transaction. It reads the ledger and
+// must be called with the chain lock held, see CreateTransaction.
+func (bc *BlockChain) AddTransaction(t *transaction.Transaction) bool {
+	if t.SenderAddress == MINING_SENDER {
+		log.Printf("ERROR: Transactions from %s can only be created by miners\n", MINING_SENDER)
+		return false
 	}
-	log.Printf("ERROR: Invalid transaction from %s\n", senderAddress)
-	return false
-}
 
-func (bc *BlockChain) VerifyTransactionSignature(senderPublicKey *ecdsa.PublicKey, s *utils.Signature, t *transaction.Transaction) bool {
-	m, err := t.MarshalJSON()
+	id, err := t.SigningHash()
 	if err != nil {
-		panic(err)
+		log.Printf("ERROR: %s\n", err)
+		return false
 	}
-	first := sha256.Sum256(m)
-	h := sha256.Sum256(first[:])
-	return ecdsa.Verify(senderPublicKey, h[:], s.R, s.S)
-}
-
-func (bc *BlockChain) Balance(blockChainAddress string) float32 {
-	var balance float32
-	for _, b := range bc.chain {
-		for _, t := range b.Transactions {
-			if t.SenderAddress == blockChainAddress {
-				balance -= t.Amount
-			}
-			if t.RecipientAddress == blockChainAddress {
-				balance += t.Amount
-			}
-		}
+	t.Id = id
+	if err := bc.validateTransaction(t); err != nil {
+		log.Printf("ERROR: Invalid transaction from %s: %s\n", t.SenderAddress, err)
+		return false
 	}
-	return balance
+	if err := bc.ledger.checkTransaction(t, bc.TransactionPool); err != nil {
+		log.Printf("ERROR: Rejected transaction from %s: %s\n", t.SenderAddress, err)
+		return false
+	}
+	if !bc.TransactionPool.Add(t) {
+		log.Printf("ERROR: Rejected transaction from %s: transaction pool is full or has it already\n", t.SenderAddress)
+		return false
+	}
+	return true
+}
+
+func (bc *BlockChain) VerifyTransactionSignature(t *transaction.Transaction) bool {
+	return t.VerifySignature() == nil
+}
+
+func (bc *BlockChain) Balance(blockChainAddress string) transaction.Amount {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.ledger.Balance(blockChainAddress)
 }
 
 type BalanceResponse struct {
-	Balance float32 `json:"balance"`
+	Balance transaction.Amount `json:"balance"`
 }
 
 func (b *BalanceResponse) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Balance float32 `json:"balance"`
+		Balance transaction.Amount `json:"balance"`
 	}{
 		Balance: b.Balance,
 	})
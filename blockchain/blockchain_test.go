@@ -0,0 +1,316 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/storage"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+// trivial accepts every block, so tests do not have to search for nonces.
+type trivial struct{}
+
+func (trivial) Solve(*block.Block) bool { return true }
+func (trivial) Verify(block.Block) bool { return true }
+
+type testKey struct {
+	key     *ecdsa.PrivateKey
+	address string
+}
+
+func newKey(t *testing.T) *testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKey{key: key, address: utils.AddressFromPublicKey(&key.PublicKey)}
+}
+
+// sign signs tx as k and sets its id. A transaction without a chain id is
+// signed for the chain of newTestChain.
+func (k *testKey) sign(t *testing.T, tx *transaction.Transaction) *transaction.Transaction {
+	t.Helper()
+	if tx.ChainId == "" {
+		tx.ChainId = "test"
+	}
+	tx.SenderAddress = k.address
+	tx.SenderPublicKey = &k.key.PublicKey
+	h, err := tx.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = &utils.Signature{R: r, S: s}
+	tx.Signature.NormalizeS(elliptic.P256())
+	tx.Id = h
+	return tx
+}
+
+// testConfig returns the configuration of a chain whose genesis block pays the
+// given allocations.
+func testConfig(ledger string, allocations ...Allocation) *Config {
+	cfg := NewConfig()
+	cfg.Ledger = ledger
+	cfg.Genesis = &Genesis{
+		ChainId:     "test",
+		Timestamp:   time.Now().Add(-time.Hour),
+		Target:      "1f00ffff",
+		Allocations: allocations,
+	}
+	return cfg
+}
+
+// newTestChain creates a chain on the memory store whose genesis block pays
+// the given allocations.
+func newTestChain(t *testing.T, ledger string, allocations ...Allocation) *BlockChain {
+	t.Helper()
+	store, err := storage.Open(&storage.Config{Backend: storage.BACKEND_MEMORY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChain(testConfig(ledger, allocations...), store, trivial{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Close() })
+	return bc
+}
+
+// child builds the block at height on top of parent, paying the reward and
+// the fees of txs to miner.
+func child(parent *block.Block, height int, miner string, txs ...*transaction.Transaction) *block.Block {
+	var fees transaction.Amount
+	for _, tx := range txs {
+		fees += tx.Fee
+	}
+	coinbase := NewCoinbaseTransaction(miner, height, fees)
+	b := block.New(0, parent.Hash(), parent.Target, append([]*transaction.Transaction{coinbase}, txs...))
+	b.Timestamp = parent.Timestamp + int64(time.Second)
+	return b
+}
+
+func createBlocks(t *testing.T, bc *BlockChain, blocks ...*block.Block) {
+	t.Helper()
+	for _, b := range blocks {
+		if err := bc.CreateBlock(b); err != nil {
+			t.Fatalf("create block %s: %v", b.HexHash(), err)
+		}
+	}
+}
+
+func TestReorganize(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	minerA, minerB := newKey(t), newKey(t)
+	const funds = 100 * transaction.COIN
+
+	tests := []struct {
+		ledger string
+		// transfer pays 10 coins and a fee of 1 coin from alice to bob.
+		transfer func(bc *BlockChain) *transaction.Transaction
+	}{
+		{
+			ledger: LEDGER_ACCOUNT,
+			transfer: func(bc *BlockChain) *transaction.Transaction {
+				return alice.sign(t, &transaction.Transaction{
+					RecipientAddress: bob.address,
+					Amount:           10 * transaction.COIN,
+					Fee:              transaction.COIN,
+					Nonce:            1,
+				})
+			},
+		},
+		{
+			ledger: LEDGER_UTXO,
+			transfer: func(bc *BlockChain) *transaction.Transaction {
+				allocation := bc.genesis.Transactions[0]
+				return alice.sign(t, &transaction.Transaction{
+					Inputs: []transaction.Input{{TxId: allocation.Id}},
+					Outputs: []transaction.Output{
+						{Address: bob.address, Amount: 10 * transaction.COIN},
+						{Address: alice.address, Amount: funds - 11*transaction.COIN},
+					},
+					Fee: transaction.COIN,
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ledger, func(t *testing.T) {
+			bc := newTestChain(t, tt.ledger, Allocation{Address: alice.address, Amount: funds})
+			var updates []*ChainUpdate
+			bc.Subscribe(func(u *ChainUpdate) { updates = append(updates, u) })
+
+			checkBalances := func(want map[string]transaction.Amount) {
+				t.Helper()
+				for address, amount := range want {
+					if got := bc.Balance(address); got != amount {
+						t.Fatalf("balance of %s = %s, want %s", address, got, amount)
+					}
+				}
+			}
+
+			tx := tt.transfer(bc)
+			if !bc.CreateTransaction(tx) {
+				t.Fatal("transfer was not pooled")
+			}
+			genesis := bc.LastBlock()
+			a1 := child(genesis, 1, minerA.address, tx)
+			createBlocks(t, bc, a1)
+			if n := len(bc.ReadTransactionsPool()); n != 0 {
+				t.Fatalf("%d transactions pooled after the transfer was mined", n)
+			}
+			checkBalances(map[string]transaction.Amount{
+				alice.address:  funds - 11*transaction.COIN,
+				bob.address:    10 * transaction.COIN,
+				minerA.address: MINING_REWARD + transaction.COIN,
+			})
+
+			// a branch of equal work does not replace the active chain
+			b1 := child(genesis, 1, minerB.address)
+			createBlocks(t, bc, b1)
+			if bc.LastBlock().Hash() != a1.Hash() {
+				t.Fatal("block of a side branch became the tip")
+			}
+
+			// a longer branch without the transfer does, and the transfer
+			// returns to the pool
+			b2 := child(b1, 2, minerB.address)
+			createBlocks(t, bc, b2)
+			if bc.LastBlock().Hash() != b2.Hash() || bc.Height() != 2 {
+				t.Fatalf("tip %s at height %d, want %s at height 2", bc.LastBlock().HexHash(), bc.Height(), b2.HexHash())
+			}
+			checkBalances(map[string]transaction.Amount{
+				alice.address:  funds,
+				bob.address:    0,
+				minerA.address: 0,
+				minerB.address: 2 * MINING_REWARD,
+			})
+			if pool := bc.ReadTransactionsPool(); len(pool) != 1 || pool[0].Id != tx.Id {
+				t.Fatalf("pool holds %d transactions, want the transfer", len(pool))
+			}
+			last := updates[len(updates)-1]
+			if len(last.Disconnected) != 1 || last.Disconnected[0].Hash() != a1.Hash() ||
+				len(last.Connected) != 2 || last.Connected[0].Hash() != b1.Hash() || last.Connected[1].Hash() != b2.Hash() {
+				t.Fatalf("update disconnects %d and connects %d blocks, want a1 and b1, b2", len(last.Disconnected), len(last.Connected))
+			}
+
+			// the first branch overtakes again and mines the transfer once more
+			a2 := child(a1, 2, minerA.address)
+			a3 := child(a2, 3, minerA.address)
+			createBlocks(t, bc, a2, a3)
+			if bc.LastBlock().Hash() != a3.Hash() {
+				t.Fatalf("tip %s, want %s", bc.LastBlock().HexHash(), a3.HexHash())
+			}
+			checkBalances(map[string]transaction.Amount{
+				alice.address:  funds - 11*transaction.COIN,
+				bob.address:    10 * transaction.COIN,
+				minerA.address: 3*MINING_REWARD + transaction.COIN,
+				minerB.address: 0,
+			})
+			if n := len(bc.ReadTransactionsPool()); n != 0 {
+				t.Fatalf("%d transactions pooled after the transfer was mined again", n)
+			}
+		})
+	}
+}
+
+func TestReorganizeToInvalidBranch(t *testing.T) {
+	alice, bob, miner := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, LEDGER_ACCOUNT, Allocation{Address: alice.address, Amount: 10 * transaction.COIN})
+	genesis := bc.LastBlock()
+	a1 := child(genesis, 1, miner.address)
+	createBlocks(t, bc, a1)
+
+	// the branch spends more than alice owns, which only shows when it is
+	// connected
+	overspend := alice.sign(t, &transaction.Transaction{
+		RecipientAddress: bob.address,
+		Amount:           20 * transaction.COIN,
+		Nonce:            1,
+	})
+	b1 := child(genesis, 1, miner.address, overspend)
+	createBlocks(t, bc, b1)
+	b2 := child(b1, 2, miner.address)
+	if err := bc.CreateBlock(b2); err == nil {
+		t.Fatal("reorganization onto an overspending branch succeeded")
+	}
+	if bc.LastBlock().Hash() != a1.Hash() {
+		t.Fatalf("tip %s, want %s", bc.LastBlock().HexHash(), a1.HexHash())
+	}
+	if got := bc.Balance(alice.address); got != 10*transaction.COIN {
+		t.Fatalf("balance of alice = %s, want %s", got, 10*transaction.COIN)
+	}
+	if err := bc.CreateBlock(child(b2, 3, miner.address)); err == nil {
+		t.Fatal("block on top of an invalid branch was accepted")
+	}
+}
+
+func TestBlockTemplate(t *testing.T) {
+	alice, bob, miner := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, LEDGER_ACCOUNT, Allocation{Address: alice.address, Amount: 10 * transaction.COIN})
+	createBlocks(t, bc, child(bc.LastBlock(), 1, miner.address))
+
+	tx := alice.sign(t, &transaction.Transaction{
+		RecipientAddress: bob.address,
+		Amount:           transaction.COIN,
+		Fee:              transaction.COIN / 10,
+		Nonce:            1,
+	})
+	if !bc.CreateTransaction(tx) {
+		t.Fatal("transfer was not pooled")
+	}
+	b := bc.BlockTemplate(miner.address)
+	if b.PreviousHash != bc.LastBlock().Hash() {
+		t.Fatalf("template builds on %x, want the tip %s", b.PreviousHash, bc.LastBlock().HexHash())
+	}
+	if len(b.Transactions) != 2 || b.Transactions[1].Id != tx.Id {
+		t.Fatalf("template has %d transactions, want the coinbase and the transfer", len(b.Transactions))
+	}
+	createBlocks(t, bc, b)
+	if got, want := bc.Balance(miner.address), 2*MINING_REWARD+tx.Fee; got != want {
+		t.Fatalf("balance of the miner = %s, want %s", got, want)
+	}
+}
+
+func TestReorganizeDropsOrphanedSpends(t *testing.T) {
+	alice, bob, miner := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, LEDGER_UTXO, Allocation{Address: alice.address, Amount: 10 * transaction.COIN})
+	genesis := bc.LastBlock()
+	a1 := child(genesis, 1, alice.address)
+	createBlocks(t, bc, a1)
+
+	// alice spends the reward of a1 and her genesis allocation
+	spendReward := alice.sign(t, &transaction.Transaction{
+		Inputs:  []transaction.Input{{TxId: a1.Transactions[0].Id}},
+		Outputs: []transaction.Output{{Address: bob.address, Amount: MINING_REWARD}},
+	})
+	spendAllocation := alice.sign(t, &transaction.Transaction{
+		Inputs:  []transaction.Input{{TxId: bc.genesis.Transactions[0].Id}},
+		Outputs: []transaction.Output{{Address: bob.address, Amount: 10 * transaction.COIN}},
+	})
+	for _, tx := range []*transaction.Transaction{spendReward, spendAllocation} {
+		if !bc.CreateTransaction(tx) {
+			t.Fatalf("transaction %s was not pooled", tx.HexHash())
+		}
+	}
+
+	b1 := child(genesis, 1, miner.address)
+	createBlocks(t, bc, b1, child(b1, 2, miner.address))
+	pool := bc.ReadTransactionsPool()
+	if len(pool) != 1 || pool[0].Id != spendAllocation.Id {
+		t.Fatalf("pool holds %d transactions after the reorganization, want only the spend of the allocation", len(pool))
+	}
+	if b := bc.BlockTemplate(miner.address); len(b.Transactions) != 2 {
+		t.Fatalf("template has %d transactions, want the coinbase and the spend of the allocation", len(b.Transactions))
+	}
+}
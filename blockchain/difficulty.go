@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+)
+
+const (
+	// POW_LIMIT is the easiest target a retarget can produce.
+	POW_LIMIT = 0x1f00ffff
+
+	TARGET_BLOCK_TIME   = 20 * time.Second
+	RETARGET_INTERVAL   = 10
+	MAX_RETARGET_FACTOR = 4
+)
+
+// requiredTarget returns the target a block on top of parent must carry. The
+// target is adjusted every RETARGET_INTERVAL blocks so that the time spent on
+// the previous interval moves towards TARGET_BLOCK_TIME per block.
+func requiredTarget(parent *blockNode) uint32 {
+	height := parent.height + 1
+	if height%RETARGET_INTERVAL != 0 {
+		return parent.block.Target
+	}
+
+	first := parent.ancestor(height - RETARGET_INTERVAL)
+	return retarget(parent.block.Target, first.block.Timestamp, parent.block.Timestamp)
+}
+
+// RequiredHeaderTarget returns the target the header at height len(headers)
+// must carry, given the header chain up to its parent starting at the genesis
+// block. It applies the same rules as full validation.
+func RequiredHeaderTarget(headers []*block.Header) uint32 {
+	height := len(headers)
+	parent := headers[height-1]
+	if height%RETARGET_INTERVAL != 0 {
+		return parent.Target
+	}
+	return retarget(parent.Target, headers[height-RETARGET_INTERVAL].Timestamp, parent.Timestamp)
+}
+
+// retarget scales target by the time taken between the first and the last
+// block of a retarget interval.
+func retarget(target uint32, first, last int64) uint32 {
+	actual := time.Duration(last - first)
+	expected := TARGET_BLOCK_TIME * (RETARGET_INTERVAL - 1)
+	if actual < expected/MAX_RETARGET_FACTOR {
+		actual = expected / MAX_RETARGET_FACTOR
+	}
+	if actual > expected*MAX_RETARGET_FACTOR {
+		actual = expected * MAX_RETARGET_FACTOR
+	}
+
+	t := block.CompactToBig(target)
+	t.Mul(t, big.NewInt(int64(actual)))
+	t.Div(t, big.NewInt(int64(expected)))
+	if limit := block.CompactToBig(POW_LIMIT); t.Cmp(limit) > 0 {
+		t = limit
+	}
+	return block.BigToCompact(t)
+}
@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+)
+
+// scaled returns target multiplied by num/den, in compact form.
+func scaled(target uint32, num, den int64) uint32 {
+	t := block.CompactToBig(target)
+	t.Mul(t, big.NewInt(num))
+	t.Div(t, big.NewInt(den))
+	return block.BigToCompact(t)
+}
+
+func TestRetarget(t *testing.T) {
+	const target = 0x1d00ffff
+	expected := int64(TARGET_BLOCK_TIME * (RETARGET_INTERVAL - 1))
+	tests := []struct {
+		name    string
+		target  uint32
+		elapsed int64
+		want    uint32
+	}{
+		{"on time", target, expected, target},
+		{"twice as fast", target, expected / 2, scaled(target, 1, 2)},
+		{"twice as slow", target, expected * 2, scaled(target, 2, 1)},
+		{"clamped when much faster", target, expected / 100, scaled(target, 1, MAX_RETARGET_FACTOR)},
+		{"clamped when much slower", target, expected * 100, scaled(target, MAX_RETARGET_FACTOR, 1)},
+		{"timestamps going back", target, -expected, scaled(target, 1, MAX_RETARGET_FACTOR)},
+		{"capped at the proof of work limit", POW_LIMIT, expected * 2, POW_LIMIT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := time.Now().UnixNano()
+			if got := retarget(tt.target, first, first+tt.elapsed); got != tt.want {
+				t.Fatalf("retarget = %08x, want %08x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredHeaderTarget(t *testing.T) {
+	const target = 0x1d00ffff
+	start := time.Now().UnixNano()
+	// blocks come twice as fast as they should
+	var headers []*block.Header
+	for i := 0; i < RETARGET_INTERVAL; i++ {
+		headers = append(headers, &block.Header{
+			Target:    target,
+			Timestamp: start + int64(i)*int64(TARGET_BLOCK_TIME/2),
+		})
+	}
+
+	for height := 1; height < RETARGET_INTERVAL; height++ {
+		if got := RequiredHeaderTarget(headers[:height]); got != target {
+			t.Fatalf("target at height %d = %08x, want %08x", height, got, target)
+		}
+	}
+	if got, want := RequiredHeaderTarget(headers), scaled(target, 1, 2); got != want {
+		t.Fatalf("target at height %d = %08x, want %08x", RETARGET_INTERVAL, got, want)
+	}
+}
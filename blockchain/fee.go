@@ -0,0 +1,72 @@
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+const (
+	MAX_BLOCK_SIZE = 1_000_000
+	// BLOCK_RESERVED_SIZE is kept free for the header and the coinbase when a
+	// block is assembled.
+	BLOCK_RESERVED_SIZE = 1_000
+	// FEE_ESTIMATE_BLOCKS is the number of recent blocks fee estimates look at.
+	FEE_ESTIMATE_BLOCKS = 10
+	// MIN_FEE_RATE is the lowest fee rate, per transaction.FEE_RATE_BYTES,
+	// that is ever suggested.
+	MIN_FEE_RATE transaction.Amount = 1_000
+)
+
+// sortByFeeRate orders txs by decreasing fee rate. Transactions of the same
+// rate keep nonce order.
+func sortByFeeRate(txs []*transaction.Transaction) []*transaction.Transaction {
+	sorted := append([]*transaction.Transaction{}, txs...)
+	rates := make(map[*transaction.Transaction]transaction.Amount, len(sorted))
+	for _, t := range sorted {
+		rates[t] = t.FeeRate()
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if rates[sorted[i]] != rates[sorted[j]] {
+			return rates[sorted[i]] > rates[sorted[j]]
+		}
+		return sorted[i].Nonce < sorted[j].Nonce
+	})
+	return sorted
+}
+
+// EstimateFeeRate suggests a fee rate, per transaction.FEE_RATE_BYTES, for a
+// transaction to be mined soon. It takes the median rate paid in recent blocks
+// and, when the pool holds more than a block can take, the rate needed to make
+// it into the next block.
+func (bc *BlockChain) EstimateFeeRate() transaction.Amount {
+	bc.mux.Lock()
+	var recent []transaction.Amount
+	for i := len(bc.chain) - 1; i >= 0 && i >= len(bc.chain)-FEE_ESTIMATE_BLOCKS; i-- {
+		for _, t := range bc.chain[i].block.Transactions {
+			if t.SenderAddress != MINING_SENDER {
+				recent = append(recent, t.FeeRate())
+			}
+		}
+	}
+	bc.mux.Unlock()
+
+	estimate := MIN_FEE_RATE
+	if len(recent) > 0 {
+		sort.Slice(recent, func(i, j int) bool { return recent[i] < recent[j] })
+		if median := recent[len(recent)/2]; median > estimate {
+			estimate = median
+		}
+	}
+
+	size := 0
+	for _, t := range sortByFeeRate(bc.TransactionPool.Read(bc.TransactionPool.Size())) {
+		if size += t.Size(); size > MAX_BLOCK_SIZE-BLOCK_RESERVED_SIZE {
+			if rate := t.FeeRate() + 1; rate > estimate {
+				estimate = rate
+			}
+			break
+		}
+	}
+	return estimate
+}
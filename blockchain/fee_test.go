@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+func ids(txs []*transaction.Transaction) []string {
+	hashes := make([]string, 0, len(txs))
+	for _, t := range txs {
+		hashes = append(hashes, t.HexHash()[:8])
+	}
+	return hashes
+}
+
+func sameTransactions(got, want []*transaction.Transaction) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i].Id != want[i].Id {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAccountSelectTransactions(t *testing.T) {
+	alice, bob, carol := newKey(t), newKey(t), newKey(t)
+	bc := newTestChain(t, LEDGER_ACCOUNT,
+		Allocation{Address: alice.address, Amount: 10 * transaction.COIN},
+		Allocation{Address: bob.address, Amount: 10 * transaction.COIN},
+	)
+	transfer := func(k *testKey, amount, fee transaction.Amount, nonce uint64) *transaction.Transaction {
+		return k.sign(t, &transaction.Transaction{RecipientAddress: carol.address, Amount: amount, Fee: fee, Nonce: nonce})
+	}
+	low := transfer(alice, transaction.COIN, transaction.COIN/100, 1)
+	// a higher fee does not let a transaction overtake the earlier nonce of
+	// its sender
+	high := transfer(alice, transaction.COIN, transaction.COIN, 2)
+	mid := transfer(bob, transaction.COIN, transaction.COIN/10, 1)
+	gap := transfer(bob, transaction.COIN, transaction.COIN, 3)
+	overspend := transfer(carol, transaction.COIN, transaction.COIN, 1)
+
+	tests := []struct {
+		name string
+		txs  []*transaction.Transaction
+		size int
+		want []*transaction.Transaction
+	}{
+		{
+			name: "highest fee rate first",
+			txs:  []*transaction.Transaction{low, mid},
+			size: MAX_BLOCK_SIZE,
+			want: []*transaction.Transaction{mid, low},
+		},
+		{
+			name: "nonce order of a sender",
+			txs:  []*transaction.Transaction{high, low, mid},
+			size: MAX_BLOCK_SIZE,
+			want: []*transaction.Transaction{mid, low, high},
+		},
+		{
+			name: "nonce gap",
+			txs:  []*transaction.Transaction{gap, mid},
+			size: MAX_BLOCK_SIZE,
+			want: []*transaction.Transaction{mid},
+		},
+		{
+			name: "more than the balance",
+			txs:  []*transaction.Transaction{overspend, low},
+			size: MAX_BLOCK_SIZE,
+			want: []*transaction.Transaction{low},
+		},
+		{
+			name: "room for one",
+			txs:  []*transaction.Transaction{low, mid},
+			size: mid.Size(),
+			want: []*transaction.Transaction{mid},
+		},
+		{
+			name: "no room",
+			txs:  []*transaction.Transaction{low, mid},
+			size: mid.Size() - 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bc.ledger.selectTransactions(tt.txs, tt.size)
+			if !sameTransactions(got, tt.want) {
+				t.Fatalf("selectTransactions = %v, want %v", ids(got), ids(tt.want))
+			}
+		})
+	}
+}
+
+func TestUTXOSelectTransactions(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	const funds = 10 * transaction.COIN
+	bc := newTestChain(t, LEDGER_UTXO,
+		Allocation{Address: alice.address, Amount: funds},
+		Allocation{Address: alice.address, Amount: funds},
+	)
+	spend := func(index int, fee transaction.Amount) *transaction.Transaction {
+		return alice.sign(t, &transaction.Transaction{
+			Inputs:  []transaction.Input{{TxId: bc.genesis.Transactions[index].Id}},
+			Outputs: []transaction.Output{{Address: bob.address, Amount: funds - fee}},
+			Fee:     fee,
+		})
+	}
+	low, high, other := spend(0, transaction.COIN/100), spend(0, transaction.COIN), spend(1, transaction.COIN/10)
+	unknown := alice.sign(t, &transaction.Transaction{
+		Inputs:  []transaction.Input{{TxId: [32]byte{1}}},
+		Outputs: []transaction.Output{{Address: bob.address, Amount: funds}},
+	})
+
+	tests := []struct {
+		name string
+		txs  []*transaction.Transaction
+		size int
+		want []*transaction.Transaction
+	}{
+		{
+			name: "highest fee rate first",
+			txs:  []*transaction.Transaction{low, other},
+			size: MAX_BLOCK_SIZE,
+			want: []*transaction.Transaction{other, low},
+		},
+		{
+			name: "conflicting spends",
+			txs:  []*transaction.Transaction{low, high, other},
+			size: MAX_BLOCK_SIZE,
+			want: []*transaction.Transaction{high, other},
+		},
+		{
+			name: "unknown input",
+			txs:  []*transaction.Transaction{unknown, low},
+			size: MAX_BLOCK_SIZE,
+			want: []*transaction.Transaction{low},
+		},
+		{
+			name: "room for one",
+			txs:  []*transaction.Transaction{low, other},
+			size: other.Size(),
+			want: []*transaction.Transaction{other},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bc.ledger.selectTransactions(tt.txs, tt.size)
+			if !sameTransactions(got, tt.want) {
+				t.Fatalf("selectTransactions = %v, want %v", ids(got), ids(tt.want))
+			}
+		})
+	}
+}
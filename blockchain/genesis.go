@@ -0,0 +1,136 @@
+package blockchain
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+//go:embed genesis.json
+var defaultGenesis []byte
+
+// Genesis specifies the genesis block of a chain. Every node of a network must
+// use the same specification, which they check by the genesis block hash.
+type Genesis struct {
+	ChainId   string    `json:"chain_id"`
+	Timestamp time.Time `json:"timestamp"`
+	// Target is the compact target in hex, which blocks keep until the first
+	// retarget.
+	Target string `json:"target"`
+	// Allocations are paid out by the genesis block.
+	Allocations []Allocation `json:"allocations"`
+}
+
+type Allocation struct {
+	Address string             `json:"address"`
+	Amount  transaction.Amount `json:"amount"`
+}
+
+// DefaultGenesis returns the genesis of the development network.
+func DefaultGenesis() *Genesis {
+	g, err := ParseGenesis(defaultGenesis)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// LoadGenesis reads a genesis specification from a JSON file.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read genesis file: %w", err)
+	}
+	g, err := ParseGenesis(data)
+	if err != nil {
+		return nil, fmt.Errorf("genesis file %s: %w", path, err)
+	}
+	return g, nil
+}
+
+func ParseGenesis(data []byte) (*Genesis, error) {
+	var g Genesis
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (g *Genesis) validate() error {
+	if g.ChainId == "" {
+		return fmt.Errorf("chain id is required")
+	}
+	if g.Timestamp.IsZero() {
+		return fmt.Errorf("timestamp is required")
+	}
+	target, err := g.target()
+	if err != nil {
+		return err
+	}
+	if t := block.CompactToBig(target); t.Sign() <= 0 || t.Cmp(block.CompactToBig(POW_LIMIT)) > 0 {
+		return fmt.Errorf("target %08x is outside of the range allowed by the proof of work limit %08x", target, POW_LIMIT)
+	}
+	var total transaction.Amount
+	for i, a := range g.Allocations {
+		if err := utils.ValidateAddress(a.Address); err != nil {
+			return fmt.Errorf("allocation %d: invalid address %q: %w", i, a.Address, err)
+		}
+		if a.Amount == 0 {
+			return fmt.Errorf("allocation %d: amount must be positive", i)
+		}
+		var ok bool
+		if total, ok = total.Add(a.Amount); !ok {
+			return fmt.Errorf("allocations exceed the maximum of %s", transaction.MAX_AMOUNT)
+		}
+	}
+	return nil
+}
+
+func (g *Genesis) target() (uint32, error) {
+	target, err := strconv.ParseUint(g.Target, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid target %q", g.Target)
+	}
+	return uint32(target), nil
+}
+
+// Block builds the genesis block. It pays every allocation with its own
+// transaction from MINING_SENDER, whose null input holds the allocation index.
+func (g *Genesis) Block() (*block.Block, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	target, _ := g.target()
+	txs := make([]*transaction.Transaction, 0, len(g.Allocations))
+	for i, a := range g.Allocations {
+		t := transaction.NewTransaction(MINING_SENDER, a.Address, a.Amount)
+		t.ChainId = g.ChainId
+		t.Inputs = []transaction.Input{{Index: uint32(i)}}
+		id, err := t.SigningHash()
+		if err != nil {
+			return nil, err
+		}
+		t.Id = id
+		txs = append(txs, t)
+	}
+	return block.NewGenesisBlock(g.Timestamp.UnixNano(), target, txs), nil
+}
+
+// Hash returns the hash of the genesis block.
+func (g *Genesis) Hash() ([32]byte, error) {
+	b, err := g.Block()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return b.Hash(), nil
+}
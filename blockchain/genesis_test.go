@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseGenesis(t *testing.T) {
+	address := newKey(t).address
+	genesis := func(target, allocations string) string {
+		return fmt.Sprintf(`{"chain_id": "test", "timestamp": "2024-01-01T00:00:00Z", "target": %q, "allocations": [%s]}`, target, allocations)
+	}
+	allocation := func(address string, amount int) string {
+		return fmt.Sprintf(`{"address": %q, "amount": %d}`, address, amount)
+	}
+
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"without allocations", genesis("1f00ffff", ""), true},
+		{"with an allocation", genesis("1f00ffff", allocation(address, 100)), true},
+		{"no chain id", `{"timestamp": "2024-01-01T00:00:00Z", "target": "1f00ffff"}`, false},
+		{"no timestamp", `{"chain_id": "test", "target": "1f00ffff"}`, false},
+		{"invalid target", genesis("target", ""), false},
+		{"zero target", genesis("00000000", ""), false},
+		{"target above the limit", genesis("2000ffff", ""), false},
+		{"allocation without an address", genesis("1f00ffff", allocation("", 100)), false},
+		{"allocation to the mining sender", genesis("1f00ffff", allocation(MINING_SENDER, 100)), false},
+		{"allocation to an invalid address", genesis("1f00ffff", allocation(corrupt(address), 100)), false},
+		{"allocation of nothing", genesis("1f00ffff", allocation(address, 0)), false},
+		{"not json", "genesis", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseGenesis([]byte(tt.data))
+			if tt.valid && err != nil {
+				t.Fatalf("ParseGenesis: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("ParseGenesis succeeded, want an error")
+			}
+		})
+	}
+}
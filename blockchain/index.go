@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"math/big"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+// TxLocation points at a transaction inside a block of the active chain.
+type TxLocation struct {
+	BlockHash [32]byte
+	Height    int
+	Index     int
+}
+
+// indexBlock adds the transactions of a newly connected block to the
+// transaction and address indexes.
+func (bc *BlockChain) indexBlock(n *blockNode) {
+	for i, t := range n.block.Transactions {
+		bc.txIndex[t.Id] = TxLocation{
+			BlockHash: n.hash,
+			Height:    n.height,
+			Index:     i,
+		}
+		for _, address := range addresses(t) {
+			bc.addrIndex[address] = append(bc.addrIndex[address], t.Id)
+		}
+	}
+}
+
+// unindexBlock removes the transactions of a disconnected block from the
+// transaction index, leaving entries that point at other blocks untouched.
+func (bc *BlockChain) unindexBlock(n *blockNode) {
+	for _, t := range n.block.Transactions {
+		if loc, ok := bc.txIndex[t.Id]; ok && loc.BlockHash == n.hash {
+			delete(bc.txIndex, t.Id)
+		}
+		for _, address := range addresses(t) {
+			ids := bc.addrIndex[address]
+			for i := len(ids) - 1; i >= 0; i-- {
+				if ids[i] == t.Id {
+					ids = append(ids[:i], ids[i+1:]...)
+					break
+				}
+			}
+			if len(ids) == 0 {
+				delete(bc.addrIndex, address)
+			} else {
+				bc.addrIndex[address] = ids
+			}
+		}
+	}
+}
+
+// addresses returns every address t spends from or pays to.
+func addresses(t *transaction.Transaction) []string {
+	var addrs []string
+	seen := make(map[string]struct{})
+	add := func(address string) {
+		if _, ok := seen[address]; !ok && address != "" && address != MINING_SENDER {
+			seen[address] = struct{}{}
+			addrs = append(addrs, address)
+		}
+	}
+	add(t.SenderAddress)
+	for _, out := range t.Outs() {
+		add(out.Address)
+	}
+	return addrs
+}
+
+// AddressTransactions returns the ids of the active chain transactions that
+// spend from or pay to address, in chain order.
+func (bc *BlockChain) AddressTransactions(address string) [][32]byte {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return append([][32]byte(nil), bc.addrIndex[address]...)
+}
+
+// HeadersAfter returns up to max headers of the active chain that follow the
+// first locator hash found on it, or that start at the genesis block if none
+// is. A max of zero or above MAX_HEADERS is capped to MAX_HEADERS.
+func (bc *BlockChain) HeadersAfter(locator [][32]byte, max int) []*block.Header {
+	if max <= 0 || max > MAX_HEADERS {
+		max = MAX_HEADERS
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	start := 0
+	for _, hash := range locator {
+		if n, ok := bc.nodes[hash]; ok && bc.inMainChain(n) {
+			start = n.height + 1
+			break
+		}
+	}
+	var headers []*block.Header
+	for height := start; height < len(bc.chain) && len(headers) < max; height++ {
+		header := bc.chain[height].block.Header
+		headers = append(headers, &header)
+	}
+	return headers
+}
+
+// BlockLocator returns hashes of the active chain from the tip back to the
+// genesis block, dense at first and then exponentially sparser, so that a
+// peer can find the last block both chains have in common.
+func (bc *BlockChain) BlockLocator() [][32]byte {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	var locator [][32]byte
+	step := 1
+	for height := bc.tip.height; height > 0; height -= step {
+		locator = append(locator, bc.chain[height].hash)
+		if len(locator) >= LOCATOR_DENSE {
+			step *= 2
+		}
+	}
+	return append(locator, bc.chain[0].hash)
+}
+
+// Tip returns the hash, height and cumulative work of the tip of the active
+// chain.
+func (bc *BlockChain) Tip() ([32]byte, int, *big.Int) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.tip.hash, bc.tip.height, new(big.Int).Set(bc.tip.work)
+}
+
+// HasBlock reports whether the block is known, on any branch.
+func (bc *BlockChain) HasBlock(hash [32]byte) bool {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	_, ok := bc.nodes[hash]
+	return ok
+}
+
+func (bc *BlockChain) blockByHeight(height int) *block.Block {
+	if height < 0 || height >= len(bc.chain) {
+		return nil
+	}
+	return bc.chain[height].block
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/trxpool"
+)
+
+const (
+	// LEDGER_ACCOUNT keeps a balance per address. Transactions move Amount
+	// from SenderAddress to RecipientAddress.
+	LEDGER_ACCOUNT = "account"
+	// LEDGER_UTXO keeps the set of unspent transaction outputs. Transactions
+	// spend whole outputs through their Inputs and create new Outputs.
+	LEDGER_UTXO = "utxo"
+)
+
+// Ledger is the state the active chain builds up from its transactions. It is
+// updated incrementally as blocks are connected and disconnected.
+type Ledger interface {
+	// Model returns the ledger model, LEDGER_ACCOUNT or LEDGER_UTXO.
+	Model() string
+	// Balance returns the amount address owns on the active chain.
+	Balance(address string) transaction.Amount
+
+	// validateTransaction checks the shape of a non-coinbase transaction
+	// without looking at the state.
+	validateTransaction(t *transaction.Transaction) error
+	// checkTransaction checks that t can be pooled on top of the state and
+	// the transactions already in pool.
+	checkTransaction(t *transaction.Transaction, pool *trxpool.TransactionPool) error
+	// selectTransactions picks the transactions of txs with the highest fee
+	// rates that fit into size bytes and can be applied together on top of
+	// the state, in the order they have to be applied.
+	selectTransactions(txs []*transaction.Transaction, size int) []*transaction.Transaction
+	// checkBlock verifies that b can be applied without side effects and
+	// returns a *BlockError otherwise.
+	checkBlock(b *block.Block) error
+	applyBlock(b *block.Block)
+	revertBlock(b *block.Block)
+}
+
+func newLedger(model string) (Ledger, error) {
+	switch model {
+	case LEDGER_ACCOUNT:
+		return NewAccountState(), nil
+	case LEDGER_UTXO:
+		return NewUTXOSet(), nil
+	default:
+		return nil, fmt.Errorf("unknown ledger model %q", model)
+	}
+}
+
+// BlockTemplate assembles the next block on top of the current tip for the
+// solver. It pays the reward and the fees to minerAddress and picks the
+// pooled transactions with the highest fee rates that can be applied on top
+// of the tip. Everything is read under one lock, so the parent, height,
+// target and transactions always belong together.
+func (bc *BlockChain) BlockTemplate(minerAddress string) *block.Block {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	// transactions stay in the pool until the block is connected to the chain
+	pooled := bc.TransactionPool.Read(bc.TransactionPool.Size())
+	selected := bc.ledger.selectTransactions(pooled, MAX_BLOCK_SIZE-BLOCK_RESERVED_SIZE)
+	var fees transaction.Amount
+	for _, t := range selected {
+		fees += t.Fee
+	}
+	coinbase := NewCoinbaseTransaction(minerAddress, bc.tip.height+1, fees)
+	transactions := append([]*transaction.Transaction{coinbase}, selected...)
+	return block.New(0, bc.tip.hash, requiredTarget(bc.tip), transactions)
+}
+
+// sumOutputs adds up the amounts of outs and fails if the total leaves the
+// valid amount range.
+func sumOutputs(outs []transaction.Output) (transaction.Amount, error) {
+	var total transaction.Amount
+	for _, out := range outs {
+		var ok bool
+		if total, ok = total.Add(out.Amount); !ok {
+			return 0, fmt.Errorf("output total exceeds the maximum of %s", transaction.MAX_AMOUNT)
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/trxpool"
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+// AccountState is the account ledger. It holds the balance and the last used
+// nonce of every address on the active chain.
+type AccountState struct {
+	balances map[string]transaction.Amount
+	nonces   map[string]uint64
+}
+
+func NewAccountState() *AccountState {
+	return &AccountState{
+		balances: make(map[string]transaction.Amount),
+		nonces:   make(map[string]uint64),
+	}
+}
+
+func (s *AccountState) Model() string {
+	return LEDGER_ACCOUNT
+}
+
+func (s *AccountState) Balance(address string) transaction.Amount {
+	return s.balances[address]
+}
+
+// NextNonce returns the nonce the next transaction of address must use.
+func (s *AccountState) NextNonce(address string) uint64 {
+	return s.nonces[address] + 1
+}
+
+func (s *AccountState) validateTransaction(t *transaction.Transaction) error {
+	if len(t.Inputs) > 0 || len(t.Outputs) > 0 {
+		return fmt.Errorf("inputs and outputs are not allowed in the %s ledger", LEDGER_ACCOUNT)
+	}
+	if t.RecipientAddress == "" {
+		return fmt.Errorf("no recipient")
+	}
+	if err := utils.ValidateAddress(t.RecipientAddress); err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	if t.Amount == 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if _, ok := t.Amount.Add(t.Fee); !ok {
+		return fmt.Errorf("amount %s and fee %s exceed the maximum of %s", t.Amount, t.Fee, transaction.MAX_AMOUNT)
+	}
+	return nil
+}
+
+func (s *AccountState) checkTransaction(t *transaction.Transaction, pool *trxpool.TransactionPool) error {
+	if next := pool.NextNonce(t.SenderAddress, s.NextNonce(t.SenderAddress)); t.Nonce != next {
+		return fmt.Errorf("nonce %d of %s does not match expected nonce %d", t.Nonce, t.SenderAddress, next)
+	}
+	balance, pending := s.Balance(t.SenderAddress), pool.PendingSpend(t.SenderAddress)
+	if balance < pending+t.Amount+t.Fee {
+		return fmt.Errorf("not enough balance in wallet %s: %s owned, %s pending, %s and a fee of %s requested", t.SenderAddress, balance, pending, t.Amount, t.Fee)
+	}
+	return nil
+}
+
+func (s *AccountState) selectTransactions(txs []*transaction.Transaction, size int) []*transaction.Transaction {
+	var selected []*transaction.Transaction
+	spent := make(map[string]transaction.Amount)
+	nonces := make(map[string]uint64)
+	remaining := sortByFeeRate(txs)
+	// a transaction becomes eligible once its sender's previous nonce has
+	// been selected, so keep passing over the rest until nothing changes
+	for progress := true; progress; {
+		progress = false
+		rest := remaining[:0]
+		for _, t := range remaining {
+			if t.Nonce != s.NextNonce(t.SenderAddress)+nonces[t.SenderAddress] ||
+				s.Balance(t.SenderAddress) < spent[t.SenderAddress]+t.Amount+t.Fee ||
+				t.Size() > size {
+				rest = append(rest, t)
+				continue
+			}
+			spent[t.SenderAddress] += t.Amount + t.Fee
+			nonces[t.SenderAddress]++
+			size -= t.Size()
+			selected = append(selected, t)
+			progress = true
+		}
+		remaining = rest
+	}
+	return selected
+}
+
+// checkBlock verifies that the transactions of every sender in b continue its
+// nonce sequence and that no sender spends more than it owns, taking earlier
+// transactions of the same block into account.
+func (s *AccountState) checkBlock(b *block.Block) error {
+	received := make(map[string]transaction.Amount)
+	spent := make(map[string]transaction.Amount)
+	nonces := make(map[string]uint64)
+	for _, t := range b.Transactions {
+		if t.SenderAddress != MINING_SENDER {
+			if next := s.NextNonce(t.SenderAddress) + nonces[t.SenderAddress]; t.Nonce != next {
+				return rejectBlock(b, REJECT_NONCE, "transaction %s has nonce %d, expected %d", t.HexHash(), t.Nonce, next)
+			}
+			nonces[t.SenderAddress]++
+			available := s.balances[t.SenderAddress] + received[t.SenderAddress] - spent[t.SenderAddress]
+			if available < t.Amount+t.Fee {
+				return rejectBlock(b, REJECT_BALANCE, "transaction %s spends %s and a fee of %s but %s only has %s", t.HexHash(), t.Amount, t.Fee, t.SenderAddress, available)
+			}
+			spent[t.SenderAddress] += t.Amount + t.Fee
+		}
+		received[t.RecipientAddress] += t.Amount
+	}
+	return nil
+}
+
+func (s *AccountState) applyBlock(b *block.Block) {
+	for _, t := range b.Transactions {
+		if t.SenderAddress != MINING_SENDER {
+			s.sub(t.SenderAddress, t.Amount+t.Fee)
+			s.nonces[t.SenderAddress] = t.Nonce
+		}
+		s.add(t.RecipientAddress, t.Amount)
+	}
+}
+
+func (s *AccountState) revertBlock(b *block.Block) {
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		t := b.Transactions[i]
+		s.sub(t.RecipientAddress, t.Amount)
+		if t.SenderAddress != MINING_SENDER {
+			s.add(t.SenderAddress, t.Amount+t.Fee)
+			if t.Nonce > 1 {
+				s.nonces[t.SenderAddress] = t.Nonce - 1
+			} else {
+				delete(s.nonces, t.SenderAddress)
+			}
+		}
+	}
+}
+
+func (s *AccountState) add(address string, amount transaction.Amount) {
+	s.balances[address] += amount
+}
+
+// sub debits address. Callers must have checked the balance covers amount.
+func (s *AccountState) sub(address string, amount transaction.Amount) {
+	balance := s.balances[address] - amount
+	if balance == 0 {
+		delete(s.balances, address)
+		return
+	}
+	s.balances[address] = balance
+}
+
+// NextNonce returns the nonce the next transaction of address must use, taking
+// its pooled transactions into account. It fails unless the chain uses the
+// account ledger.
+func (bc *BlockChain) NextNonce(address string) (uint64, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	state, ok := bc.ledger.(*AccountState)
+	if !ok {
+		return 0, fmt.Errorf("the chain uses the %s ledger", bc.ledger.Model())
+	}
+	return bc.TransactionPool.NextNonce(address, state.NextNonce(address)), nil
+}
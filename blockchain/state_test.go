@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+// corrupt changes the last character of a base58 address.
+func corrupt(address string) string {
+	last := "1"
+	if address[len(address)-1] == '1' {
+		last = "2"
+	}
+	return address[:len(address)-1] + last
+}
+
+func TestAccountTransactionRules(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	const funds = 10 * transaction.COIN
+
+	tests := []struct {
+		name   string
+		modify func(tx *transaction.Transaction)
+		valid  bool
+	}{
+		{
+			name:   "valid",
+			modify: func(tx *transaction.Transaction) {},
+			valid:  true,
+		},
+		{
+			name:   "whole balance",
+			modify: func(tx *transaction.Transaction) { tx.Amount = funds - tx.Fee },
+			valid:  true,
+		},
+		{
+			name:   "no recipient",
+			modify: func(tx *transaction.Transaction) { tx.RecipientAddress = "" },
+		},
+		{
+			name:   "invalid recipient",
+			modify: func(tx *transaction.Transaction) { tx.RecipientAddress = "recipient" },
+		},
+		{
+			name:   "recipient with a bad checksum",
+			modify: func(tx *transaction.Transaction) { tx.RecipientAddress = corrupt(bob.address) },
+		},
+		{
+			name:   "zero amount",
+			modify: func(tx *transaction.Transaction) { tx.Amount = 0 },
+		},
+		{
+			name:   "more than the balance",
+			modify: func(tx *transaction.Transaction) { tx.Amount = funds },
+		},
+		{
+			name:   "amount and fee overflow",
+			modify: func(tx *transaction.Transaction) { tx.Amount, tx.Fee = transaction.MAX_AMOUNT, 1 },
+		},
+		{
+			name:   "nonce zero",
+			modify: func(tx *transaction.Transaction) { tx.Nonce = 0 },
+		},
+		{
+			name:   "nonce gap",
+			modify: func(tx *transaction.Transaction) { tx.Nonce = 2 },
+		},
+		{
+			name:   "other chain",
+			modify: func(tx *transaction.Transaction) { tx.ChainId = "other" },
+		},
+		{
+			name:   "inputs",
+			modify: func(tx *transaction.Transaction) { tx.Inputs = []transaction.Input{{TxId: [32]byte{1}}} },
+		},
+		{
+			name: "outputs",
+			modify: func(tx *transaction.Transaction) {
+				tx.Outputs = []transaction.Output{{Address: bob.address, Amount: tx.Amount}}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newTestChain(t, LEDGER_ACCOUNT, Allocation{Address: alice.address, Amount: funds})
+			tx := &transaction.Transaction{
+				RecipientAddress: bob.address,
+				Amount:           transaction.COIN,
+				Fee:              transaction.COIN / 10,
+				Nonce:            1,
+			}
+			tt.modify(tx)
+			alice.sign(t, tx)
+			if got := bc.CreateTransaction(tx); got != tt.valid {
+				t.Fatalf("CreateTransaction = %t, want %t", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAccountPendingTransactions(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	bc := newTestChain(t, LEDGER_ACCOUNT, Allocation{Address: alice.address, Amount: 10 * transaction.COIN})
+	transfer := func(amount transaction.Amount, nonce uint64) *transaction.Transaction {
+		return alice.sign(t, &transaction.Transaction{RecipientAddress: bob.address, Amount: amount, Nonce: nonce})
+	}
+
+	if !bc.CreateTransaction(transfer(6*transaction.COIN, 1)) {
+		t.Fatal("first transfer was not pooled")
+	}
+	if bc.CreateTransaction(transfer(transaction.COIN, 1)) {
+		t.Fatal("transfer reusing a pooled nonce was pooled")
+	}
+	// the pooled transfer is spent already
+	if bc.CreateTransaction(transfer(5*transaction.COIN, 2)) {
+		t.Fatal("transfer spending more than the pending balance was pooled")
+	}
+	if !bc.CreateTransaction(transfer(4*transaction.COIN, 2)) {
+		t.Fatal("transfer following the pooled nonce was not pooled")
+	}
+}
@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/storage"
+)
+
+var (
+	blocksBucket = []byte("blocks")
+	chainBucket  = []byte("chain")
+	tipKey       = []byte("tip")
+	ledgerKey    = []byte("ledger")
+	chainIdKey   = []byte("chain_id")
+)
+
+// storeBlock stores b and, if tip is set, records it as the tip of the active
+// chain in the same write, so that the stored tip always has its block.
+func (bc *BlockChain) storeBlock(b *block.Block, tip bool) error {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encode block: %w", err)
+	}
+	hash := b.Hash()
+	entries := []storage.Entry{{Bucket: blocksBucket, Key: hash[:], Value: data}}
+	if tip {
+		entries = append(entries, storage.Entry{Bucket: chainBucket, Key: tipKey, Value: hash[:]})
+	}
+	if err := bc.store.PutAll(entries); err != nil {
+		return fmt.Errorf("store block %x: %w", hash, err)
+	}
+	return nil
+}
+
+// checkChainParams makes sure the stored chain was built with the configured
+// chain id and ledger model and records them for a new chain.
+func (bc *BlockChain) checkChainParams() error {
+	if err := bc.checkChainParam(chainIdKey, "chain id", bc.chainId); err != nil {
+		return err
+	}
+	return bc.checkChainParam(ledgerKey, "ledger model", bc.ledger.Model())
+}
+
+func (bc *BlockChain) checkChainParam(key []byte, name, value string) error {
+	stored, err := bc.store.Get(chainBucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		if err := bc.store.Put(chainBucket, key, []byte(value)); err != nil {
+			return fmt.Errorf("store %s: %w", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	if string(stored) != value {
+		return fmt.Errorf("chain data uses %s %q, not %q", name, stored, value)
+	}
+	return nil
+}
+
+// loadChain rebuilds the block tree from every stored block, running each of
+// them through the validation pipeline again, and restores the active chain
+// up to the stored tip. It leaves the chain empty if the store has no tip.
+func (bc *BlockChain) loadChain() error {
+	tip, err := bc.store.Get(chainBucket, tipKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read chain tip: %w", err)
+	}
+	var tipHash [32]byte
+	copy(tipHash[:], tip)
+
+	blocks := make(map[[32]byte]*block.Block)
+	children := make(map[[32]byte][]*block.Block)
+	err = bc.store.ForEach(blocksBucket, func(key, value []byte) error {
+		var b block.Block
+		if err := b.UnmarshalBinary(value); err != nil {
+			return fmt.Errorf("stored block %x: %w", key, err)
+		}
+		hash := b.Hash()
+		if string(hash[:]) != string(key) {
+			return fmt.Errorf("block %x: stored hash does not match its content", key)
+		}
+		blocks[hash] = &b
+		children[b.PreviousHash] = append(children[b.PreviousHash], &b)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	genesis, ok := blocks[tipHash]
+	if !ok {
+		return fmt.Errorf("chain tip %x not found", tipHash)
+	}
+	for genesis.PreviousHash != [32]byte{} {
+		if genesis, ok = blocks[genesis.PreviousHash]; !ok {
+			return fmt.Errorf("chain tip %x is not connected to a genesis block", tipHash)
+		}
+	}
+	if hash, want := genesis.Hash(), bc.genesis.Hash(); hash != want {
+		return fmt.Errorf("stored chain has genesis block %x, not %x of the genesis specification", hash, want)
+	}
+
+	queue := []*block.Block{genesis}
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+
+		var parent *blockNode
+		if b != genesis {
+			parent = bc.nodes[b.PreviousHash]
+		}
+		if err := bc.validateBlock(b, parent); err != nil {
+			return fmt.Errorf("stored block: %w", err)
+		}
+		n := newBlockNode(b, parent)
+		bc.nodes[n.hash] = n
+		queue = append(queue, children[n.hash]...)
+	}
+	if skipped := len(blocks) - len(bc.nodes); skipped > 0 {
+		log.Printf("[BLOCKCHAIN] Skipped %d stored blocks that do not connect to the genesis block\n", skipped)
+	}
+
+	bc.tip = bc.nodes[tipHash]
+	bc.chain = make([]*blockNode, bc.tip.height+1)
+	for n := bc.tip; n != nil; n = n.parent {
+		bc.chain[n.height] = n
+	}
+	for _, n := range bc.chain {
+		if err := bc.connectBlock(n); err != nil {
+			return fmt.Errorf("stored block %x at height %d: %w", n.hash, n.height, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/storage"
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+func TestLoadChain(t *testing.T) {
+	alice, bob, miner := newKey(t), newKey(t), newKey(t)
+	cfg := testConfig(LEDGER_ACCOUNT, Allocation{Address: alice.address, Amount: 10 * transaction.COIN})
+	storeCfg := &storage.Config{DataDir: t.TempDir(), Backend: storage.BACKEND_BOLT}
+	open := func() *BlockChain {
+		t.Helper()
+		store, err := storage.Open(storeCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bc, err := NewBlockChain(cfg, store, trivial{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bc
+	}
+
+	bc := open()
+	genesis := bc.LastBlock()
+	tx := alice.sign(t, &transaction.Transaction{
+		RecipientAddress: bob.address,
+		Amount:           transaction.COIN,
+		Nonce:            1,
+	})
+	a1 := child(genesis, 1, miner.address, tx)
+	a2 := child(a1, 2, miner.address)
+	side := child(genesis, 1, bob.address)
+	createBlocks(t, bc, a1, a2, side)
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bc = open()
+	defer bc.Close()
+	if bc.LastBlock().Hash() != a2.Hash() || bc.Height() != 2 {
+		t.Fatalf("loaded tip %s at height %d, want %s at height 2", bc.LastBlock().HexHash(), bc.Height(), a2.HexHash())
+	}
+	for address, want := range map[string]transaction.Amount{
+		alice.address: 9 * transaction.COIN,
+		bob.address:   transaction.COIN,
+		miner.address: 2 * MINING_REWARD,
+	} {
+		if got := bc.Balance(address); got != want {
+			t.Fatalf("balance of %s = %s, want %s", address, got, want)
+		}
+	}
+	if _, err := bc.GetBlock(side.Hash()); err != nil {
+		t.Fatalf("side branch block was not loaded: %v", err)
+	}
+	if _, err := bc.GetTransactionByHash(tx.HexHash()); err != nil {
+		t.Fatalf("transaction index was not rebuilt: %v", err)
+	}
+	// the nonce of alice continues after the loaded transaction
+	next := alice.sign(t, &transaction.Transaction{RecipientAddress: bob.address, Amount: transaction.COIN, Nonce: 2})
+	if !bc.CreateTransaction(next) {
+		t.Fatal("transaction following the loaded nonce was not pooled")
+	}
+}
+
+func TestLoadChainRejectsOtherGenesis(t *testing.T) {
+	storeCfg := &storage.Config{DataDir: t.TempDir(), Backend: storage.BACKEND_BOLT}
+	store, err := storage.Open(storeCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(LEDGER_ACCOUNT)
+	bc, err := NewBlockChain(cfg, store, trivial{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Close()
+
+	store, err = storage.Open(storeCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	cfg.Genesis.Timestamp = cfg.Genesis.Timestamp.Add(-time.Minute)
+	if _, err := NewBlockChain(cfg, store, trivial{}); err == nil {
+		t.Fatal("chain with another genesis block was loaded")
+	}
+}
@@ -0,0 +1,200 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"github.com/fr13n8/go-blockchain/block"
+)
+
+// blockNode is an entry in the block tree. Every valid block the node has seen
+// gets a node, whether or not it is part of the active chain.
+type blockNode struct {
+	block  *block.Block
+	hash   [32]byte
+	parent *blockNode
+	height int
+	// work is the cumulative proof of work of the branch ending at this node.
+	work *big.Int
+	// invalid is set when the block failed to connect to the ledger.
+	invalid bool
+}
+
+func newBlockNode(b *block.Block, parent *blockNode) *blockNode {
+	n := &blockNode{
+		block:  b,
+		hash:   b.Hash(),
+		parent: parent,
+		work:   CalcWork(b.Target),
+	}
+	if parent != nil {
+		n.height = parent.height + 1
+		n.work.Add(n.work, parent.work)
+	}
+	return n
+}
+
+// ancestor returns the node at the given height on the branch ending at n.
+func (n *blockNode) ancestor(height int) *blockNode {
+	if height < 0 || height > n.height {
+		return nil
+	}
+	node := n
+	for node != nil && node.height > height {
+		node = node.parent
+	}
+	return node
+}
+
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// CalcWork returns the expected number of hashes needed to find a block
+// under the given compact target, 2^256 / (target + 1).
+func CalcWork(target uint32) *big.Int {
+	t := block.CompactToBig(target)
+	return new(big.Int).Div(oneLsh256, t.Add(t, big.NewInt(1)))
+}
+
+// findFork returns the last node that the active chain and the branch ending
+// at n have in common.
+func (bc *BlockChain) findFork(n *blockNode) *blockNode {
+	for n != nil && !bc.inMainChain(n) {
+		n = n.parent
+	}
+	return n
+}
+
+func (bc *BlockChain) inMainChain(n *blockNode) bool {
+	return n.height < len(bc.chain) && bc.chain[n.height] == n
+}
+
+// reorganize makes the branch ending at newTip the active chain. Blocks above
+// the fork point are disconnected from the tip downwards, then the new branch
+// is connected from the fork point upwards. newTip is stored in the same write
+// that records it as the tip; the rest of the branch is stored already.
+func (bc *BlockChain) reorganize(newTip *blockNode) (*ChainUpdate, error) {
+	fork := bc.findFork(newTip)
+	forkHeight := -1
+	if fork != nil {
+		forkHeight = fork.height
+	}
+
+	var connect []*blockNode
+	for n := newTip; n != fork; n = n.parent {
+		connect = append([]*blockNode{n}, connect...)
+	}
+
+	update := &ChainUpdate{}
+	oldChain := append([]*blockNode{}, bc.chain[forkHeight+1:]...)
+	bc.disconnectAbove(forkHeight, update)
+
+	for _, n := range connect {
+		if err := bc.connectBlock(n); err != nil {
+			// everything from the failing block up to newTip builds on an invalid state
+			for m := newTip; m != n.parent; m = m.parent {
+				m.invalid = true
+			}
+			bc.disconnectAbove(forkHeight, nil)
+			for _, old := range oldChain {
+				if err := bc.connectBlock(old); err != nil {
+					return nil, fmt.Errorf("restore block %x: %w", old.hash, err)
+				}
+				bc.chain = append(bc.chain, old)
+			}
+			bc.refreshPool()
+			return nil, err
+		}
+		bc.chain = append(bc.chain, n)
+		update.Connected = append(update.Connected, n.block)
+	}
+	bc.tip = newTip
+	if len(update.Disconnected) > 0 {
+		bc.refreshPool()
+	}
+
+	if err := bc.storeBlock(newTip.block, true); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// disconnectAbove disconnects the active chain down to the given height and
+// records the removed blocks in update, if any.
+func (bc *BlockChain) disconnectAbove(height int, update *ChainUpdate) {
+	for i := len(bc.chain) - 1; i > height; i-- {
+		n := bc.chain[i]
+		bc.disconnectBlock(n)
+		if update != nil {
+			update.Disconnected = append(update.Disconnected, n.block)
+		}
+	}
+	bc.chain = bc.chain[:height+1]
+}
+
+// connectBlock applies a block to the ledger and the indexes. It fails without
+// side effects if the block spends funds its senders do not own.
+func (bc *BlockChain) connectBlock(n *blockNode) error {
+	if err := bc.ledger.checkBlock(n.block); err != nil {
+		return err
+	}
+	bc.ledger.applyBlock(n.block)
+	bc.indexBlock(n)
+	bc.TransactionPool.Remove(n.block.Transactions)
+	return nil
+}
+
+// disconnectBlock reverts a block from the ledger and the indexes and
+// returns its transactions to the pool, so they can be mined again on the new
+// branch. Whether they still apply is checked by refreshPool once the new
+// branch is connected.
+func (bc *BlockChain) disconnectBlock(n *blockNode) {
+	bc.ledger.revertBlock(n.block)
+	bc.unindexBlock(n)
+	for _, t := range n.block.Transactions {
+		if t.SenderAddress == MINING_SENDER {
+			continue
+		}
+		bc.TransactionPool.Add(t)
+	}
+}
+
+// refreshPool checks every pooled transaction against the ledger after blocks
+// were disconnected and drops those that no longer apply, such as spends of
+// outputs that only existed on the abandoned branch. The transactions of a
+// sender are checked in nonce order, so that each one sees the ones before
+// it in the pool.
+func (bc *BlockChain) refreshPool() {
+	txs := bc.TransactionPool.Drain()
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].Nonce < txs[j].Nonce })
+	for _, t := range txs {
+		if err := bc.ledger.checkTransaction(t, bc.TransactionPool); err != nil {
+			log.Printf("[BLOCKCHAIN] Dropping transaction %s from the pool: %s\n", t.HexHash(), err)
+			continue
+		}
+		bc.TransactionPool.Add(t)
+	}
+}
+
+// ChainUpdate describes a change of the active chain. Disconnected blocks are
+// listed from the old tip downwards, connected blocks from the fork point up.
+type ChainUpdate struct {
+	Disconnected []*block.Block
+	Connected    []*block.Block
+}
+
+// Subscribe registers fn to be called after every change of the active chain.
+// Updates are delivered in order and outside of the chain lock.
+func (bc *BlockChain) Subscribe(fn func(*ChainUpdate)) {
+	bc.notifyMux.Lock()
+	defer bc.notifyMux.Unlock()
+	bc.subscribers = append(bc.subscribers, fn)
+}
+
+// notify must be called with notifyMux held.
+func (bc *BlockChain) notify(update *ChainUpdate) {
+	for _, fn := range bc.subscribers {
+		fn(update)
+	}
+}
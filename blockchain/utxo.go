@@ -0,0 +1,259 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/trxpool"
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+// UnspentOutput is an output of the active chain that has not been spent yet,
+// together with the input that spends it.
+type UnspentOutput struct {
+	transaction.Input
+	transaction.Output
+}
+
+type spentOutput struct {
+	in  transaction.Input
+	out transaction.Output
+}
+
+// UTXOSet is the UTXO ledger. It holds every unspent output of the active
+// chain, keyed by the input that spends it.
+type UTXOSet struct {
+	outputs map[transaction.Input]transaction.Output
+	// undo holds the outputs spent by each connected block, so that they can
+	// be restored when the block is disconnected.
+	undo map[[32]byte][]spentOutput
+}
+
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{
+		outputs: make(map[transaction.Input]transaction.Output),
+		undo:    make(map[[32]byte][]spentOutput),
+	}
+}
+
+func (s *UTXOSet) Model() string {
+	return LEDGER_UTXO
+}
+
+func (s *UTXOSet) Balance(address string) transaction.Amount {
+	var balance transaction.Amount
+	for _, out := range s.outputs {
+		if out.Address == address {
+			balance += out.Amount
+		}
+	}
+	return balance
+}
+
+// Unspent returns the unspent outputs owned by address, ordered by
+// transaction id and index.
+func (s *UTXOSet) Unspent(address string) []UnspentOutput {
+	var unspent []UnspentOutput
+	for in, out := range s.outputs {
+		if out.Address == address {
+			unspent = append(unspent, UnspentOutput{Input: in, Output: out})
+		}
+	}
+	sort.Slice(unspent, func(i, j int) bool {
+		if c := bytes.Compare(unspent[i].TxId[:], unspent[j].TxId[:]); c != 0 {
+			return c < 0
+		}
+		return unspent[i].Index < unspent[j].Index
+	})
+	return unspent
+}
+
+func (s *UTXOSet) validateTransaction(t *transaction.Transaction) error {
+	if t.RecipientAddress != "" || t.Amount != 0 {
+		return fmt.Errorf("recipient and amount must be expressed as outputs in the %s ledger", LEDGER_UTXO)
+	}
+	if t.Nonce != 0 {
+		return fmt.Errorf("nonces are not used in the %s ledger", LEDGER_UTXO)
+	}
+	if len(t.Inputs) == 0 {
+		return fmt.Errorf("no inputs")
+	}
+	if len(t.Outputs) == 0 {
+		return fmt.Errorf("no outputs")
+	}
+	seen := make(map[transaction.Input]struct{}, len(t.Inputs))
+	for _, in := range t.Inputs {
+		if in.IsNull() {
+			return fmt.Errorf("null input")
+		}
+		if _, ok := seen[in]; ok {
+			return fmt.Errorf("input %s is spent twice", in)
+		}
+		seen[in] = struct{}{}
+	}
+	for i, out := range t.Outputs {
+		if out.Amount == 0 {
+			return fmt.Errorf("output %d: amount must be positive", i)
+		}
+		if err := utils.ValidateAddress(out.Address); err != nil {
+			return fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	total, err := sumOutputs(t.Outputs)
+	if err != nil {
+		return err
+	}
+	if _, ok := total.Add(t.Fee); !ok {
+		return fmt.Errorf("outputs of %s and fee %s exceed the maximum of %s", total, t.Fee, transaction.MAX_AMOUNT)
+	}
+	return nil
+}
+
+func (s *UTXOSet) checkTransaction(t *transaction.Transaction, pool *trxpool.TransactionPool) error {
+	spent := make([]transaction.Output, 0, len(t.Inputs))
+	for _, in := range t.Inputs {
+		out, ok := s.outputs[in]
+		if !ok {
+			return fmt.Errorf("input %s is not an unspent output", in)
+		}
+		if pool.IsSpent(in) {
+			return fmt.Errorf("input %s is already spent by a pooled transaction", in)
+		}
+		spent = append(spent, out)
+	}
+	return checkSpend(t, spent)
+}
+
+func (s *UTXOSet) selectTransactions(txs []*transaction.Transaction, size int) []*transaction.Transaction {
+	var selected []*transaction.Transaction
+	spent := make(map[transaction.Input]struct{})
+	for _, t := range sortByFeeRate(txs) {
+		if t.Size() > size || !s.canSpend(t, spent) {
+			continue
+		}
+		for _, in := range t.Inputs {
+			spent[in] = struct{}{}
+		}
+		size -= t.Size()
+		selected = append(selected, t)
+	}
+	return selected
+}
+
+func (s *UTXOSet) canSpend(t *transaction.Transaction, spent map[transaction.Input]struct{}) bool {
+	for _, in := range t.Inputs {
+		if _, ok := s.outputs[in]; !ok {
+			return false
+		}
+		if _, ok := spent[in]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkBlock verifies that every input of b spends an output that is unspent
+// at that point of the block, either in the set or created by an earlier
+// transaction of the same block.
+func (s *UTXOSet) checkBlock(b *block.Block) error {
+	created := make(map[transaction.Input]transaction.Output)
+	spent := make(map[transaction.Input]struct{})
+	for _, t := range b.Transactions {
+		if t.SenderAddress != MINING_SENDER {
+			outs := make([]transaction.Output, 0, len(t.Inputs))
+			for _, in := range t.Inputs {
+				if _, ok := spent[in]; ok {
+					return rejectBlock(b, REJECT_DOUBLE_SPEND, "transaction %s spends %s twice in the block", t.HexHash(), in)
+				}
+				out, ok := created[in]
+				if !ok {
+					if out, ok = s.outputs[in]; !ok {
+						return rejectBlock(b, REJECT_DOUBLE_SPEND, "transaction %s spends missing or spent output %s", t.HexHash(), in)
+					}
+				}
+				spent[in] = struct{}{}
+				outs = append(outs, out)
+			}
+			if err := checkSpend(t, outs); err != nil {
+				return rejectBlock(b, REJECT_BALANCE, "transaction %s: %s", t.HexHash(), err)
+			}
+		}
+		for i, out := range t.Outs() {
+			created[transaction.Input{TxId: t.Id, Index: uint32(i)}] = out
+		}
+	}
+	return nil
+}
+
+func (s *UTXOSet) applyBlock(b *block.Block) {
+	var spent []spentOutput
+	for _, t := range b.Transactions {
+		if t.SenderAddress != MINING_SENDER {
+			for _, in := range t.Inputs {
+				spent = append(spent, spentOutput{in: in, out: s.outputs[in]})
+				delete(s.outputs, in)
+			}
+		}
+		for i, out := range t.Outs() {
+			s.outputs[transaction.Input{TxId: t.Id, Index: uint32(i)}] = out
+		}
+	}
+	s.undo[b.Hash()] = spent
+}
+
+func (s *UTXOSet) revertBlock(b *block.Block) {
+	for _, t := range b.Transactions {
+		for i := range t.Outs() {
+			delete(s.outputs, transaction.Input{TxId: t.Id, Index: uint32(i)})
+		}
+	}
+	hash := b.Hash()
+	for _, spent := range s.undo[hash] {
+		s.outputs[spent.in] = spent.out
+	}
+	delete(s.undo, hash)
+}
+
+// checkSpend verifies that the outputs spent by t belong to its sender and
+// add up to exactly the value of its outputs plus its fee.
+func checkSpend(t *transaction.Transaction, spent []transaction.Output) error {
+	for i, out := range spent {
+		if out.Address != t.SenderAddress {
+			return fmt.Errorf("input %s belongs to %s, not %s", t.Inputs[i], out.Address, t.SenderAddress)
+		}
+	}
+	in, err := sumOutputs(spent)
+	if err != nil {
+		return err
+	}
+	out, err := sumOutputs(t.Outputs)
+	if err != nil {
+		return err
+	}
+	if in != out+t.Fee {
+		return fmt.Errorf("inputs of %s do not match outputs of %s and a fee of %s", in, out, t.Fee)
+	}
+	return nil
+}
+
+// UnspentOutputs returns the unspent outputs owned by address that are not
+// spent by a pooled transaction yet. It fails unless the chain uses the UTXO
+// ledger.
+func (bc *BlockChain) UnspentOutputs(address string) ([]UnspentOutput, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	set, ok := bc.ledger.(*UTXOSet)
+	if !ok {
+		return nil, fmt.Errorf("the chain uses the %s ledger", bc.ledger.Model())
+	}
+	var unspent []UnspentOutput
+	for _, u := range set.Unspent(address) {
+		if !bc.TransactionPool.IsSpent(u.Input) {
+			unspent = append(unspent, u)
+		}
+	}
+	return unspent, nil
+}
@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+func TestUTXOTransactionRules(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	const funds = 10 * transaction.COIN
+
+	tests := []struct {
+		name   string
+		modify func(tx *transaction.Transaction)
+		valid  bool
+	}{
+		{
+			name:   "valid",
+			modify: func(tx *transaction.Transaction) {},
+			valid:  true,
+		},
+		{
+			name: "no change",
+			modify: func(tx *transaction.Transaction) {
+				tx.Outputs = []transaction.Output{{Address: bob.address, Amount: funds - tx.Fee}}
+			},
+			valid: true,
+		},
+		{
+			name:   "no inputs",
+			modify: func(tx *transaction.Transaction) { tx.Inputs = nil },
+		},
+		{
+			name:   "no outputs",
+			modify: func(tx *transaction.Transaction) { tx.Outputs = nil },
+		},
+		{
+			name:   "null input",
+			modify: func(tx *transaction.Transaction) { tx.Inputs = []transaction.Input{{}} },
+		},
+		{
+			name:   "input spent twice",
+			modify: func(tx *transaction.Transaction) { tx.Inputs = append(tx.Inputs, tx.Inputs[0]) },
+		},
+		{
+			name:   "unknown input",
+			modify: func(tx *transaction.Transaction) { tx.Inputs[0].Index = 1 },
+		},
+		{
+			name:   "zero output",
+			modify: func(tx *transaction.Transaction) { tx.Outputs[0].Amount = 0 },
+		},
+		{
+			name:   "output without an address",
+			modify: func(tx *transaction.Transaction) { tx.Outputs[0].Address = "" },
+		},
+		{
+			name:   "output to an invalid address",
+			modify: func(tx *transaction.Transaction) { tx.Outputs[0].Address = corrupt(bob.address) },
+		},
+		{
+			name:   "outputs exceed inputs",
+			modify: func(tx *transaction.Transaction) { tx.Outputs[0].Amount++ },
+		},
+		{
+			name:   "outputs fall short of inputs",
+			modify: func(tx *transaction.Transaction) { tx.Outputs[0].Amount-- },
+		},
+		{
+			name:   "recipient",
+			modify: func(tx *transaction.Transaction) { tx.RecipientAddress = bob.address },
+		},
+		{
+			name:   "amount",
+			modify: func(tx *transaction.Transaction) { tx.Amount = transaction.COIN },
+		},
+		{
+			name:   "nonce",
+			modify: func(tx *transaction.Transaction) { tx.Nonce = 1 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newTestChain(t, LEDGER_UTXO, Allocation{Address: alice.address, Amount: funds})
+			tx := &transaction.Transaction{
+				Inputs: []transaction.Input{{TxId: bc.genesis.Transactions[0].Id}},
+				Outputs: []transaction.Output{
+					{Address: bob.address, Amount: transaction.COIN},
+					{Address: alice.address, Amount: funds - transaction.COIN - transaction.COIN/10},
+				},
+				Fee: transaction.COIN / 10,
+			}
+			tt.modify(tx)
+			alice.sign(t, tx)
+			if got := bc.CreateTransaction(tx); got != tt.valid {
+				t.Fatalf("CreateTransaction = %t, want %t", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestUTXOSpendOwnership(t *testing.T) {
+	alice, bob := newKey(t), newKey(t)
+	bc := newTestChain(t, LEDGER_UTXO, Allocation{Address: alice.address, Amount: 10 * transaction.COIN})
+	spend := func(k *testKey, recipient string) *transaction.Transaction {
+		return k.sign(t, &transaction.Transaction{
+			Inputs:  []transaction.Input{{TxId: bc.genesis.Transactions[0].Id}},
+			Outputs: []transaction.Output{{Address: recipient, Amount: 10 * transaction.COIN}},
+		})
+	}
+
+	if bc.CreateTransaction(spend(bob, bob.address)) {
+		t.Fatal("spend of an output owned by someone else was pooled")
+	}
+	if !bc.CreateTransaction(spend(alice, bob.address)) {
+		t.Fatal("spend of an owned output was not pooled")
+	}
+	if bc.CreateTransaction(spend(alice, alice.address)) {
+		t.Fatal("second spend of a pooled input was pooled")
+	}
+}
@@ -0,0 +1,241 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+const (
+	MEDIAN_TIME_BLOCKS    = 11
+	MAX_FUTURE_BLOCK_TIME = 2 * time.Hour
+)
+
+type RejectCode string
+
+const (
+	REJECT_DUPLICATE     RejectCode = "duplicate"
+	REJECT_ORPHAN        RejectCode = "orphan"
+	REJECT_INVALID_CHAIN RejectCode = "invalid-chain"
+	REJECT_PREVIOUS_HASH RejectCode = "bad-previous-hash"
+	REJECT_MERKLE_ROOT   RejectCode = "bad-merkle-root"
+	REJECT_DIFFICULTY    RejectCode = "bad-difficulty"
+	REJECT_PROOF_OF_WORK RejectCode = "bad-proof-of-work"
+	REJECT_TIMESTAMP     RejectCode = "bad-timestamp"
+	REJECT_COINBASE      RejectCode = "bad-coinbase"
+	REJECT_TRANSACTION   RejectCode = "bad-transaction"
+	REJECT_BALANCE       RejectCode = "insufficient-balance"
+	REJECT_DOUBLE_SPEND  RejectCode = "double-spend"
+	REJECT_NONCE         RejectCode = "bad-nonce"
+	REJECT_BLOCK_SIZE    RejectCode = "bad-block-size"
+	REJECT_GENESIS       RejectCode = "bad-genesis"
+	// REJECT_TIME_TOO_NEW rejects a block that is too far ahead of the local
+	// clock. It breaks no rule: the block may be accepted later.
+	REJECT_TIME_TOO_NEW RejectCode = "time-too-new"
+)
+
+// BlockError is returned when a block is rejected by the consensus rules.
+type BlockError struct {
+	Code   RejectCode
+	Hash   [32]byte
+	Reason string
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("block %x rejected (%s): %s", e.Hash, e.Code, e.Reason)
+}
+
+func rejectBlock(b *block.Block, code RejectCode, format string, args ...interface{}) *BlockError {
+	return &BlockError{
+		Code:   code,
+		Hash:   b.Hash(),
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// validateBlock runs the full consensus pipeline for b on top of parent. A nil
+// parent means b is validated as the genesis block.
+func (bc *BlockChain) validateBlock(b *block.Block, parent *blockNode) error {
+	if parent == nil {
+		return bc.validateGenesisBlock(b)
+	}
+
+	if err := bc.validateHeader(b, parent); err != nil {
+		return err
+	}
+	if !b.VerifyMerkleRoot() {
+		return rejectBlock(b, REJECT_MERKLE_ROOT, "merkle root does not match transactions")
+	}
+	if size := b.Size(); size > MAX_BLOCK_SIZE {
+		return rejectBlock(b, REJECT_BLOCK_SIZE, "size %d exceeds the maximum of %d bytes", size, MAX_BLOCK_SIZE)
+	}
+	return bc.validateTransactions(b, parent.height+1)
+}
+
+// validateHeader runs the checks that only need the header of b.
+func (bc *BlockChain) validateHeader(b *block.Block, parent *blockNode) error {
+	if b.PreviousHash != parent.hash {
+		return rejectBlock(b, REJECT_PREVIOUS_HASH, "previous hash %x does not match parent %x", b.PreviousHash, parent.hash)
+	}
+	if target := requiredTarget(parent); b.Target != target {
+		return rejectBlock(b, REJECT_DIFFICULTY, "target %08x does not match required target %08x", b.Target, target)
+	}
+	if !bc.solver.Verify(*b) {
+		return rejectBlock(b, REJECT_PROOF_OF_WORK, "hash does not satisfy target %08x", b.Target)
+	}
+	return validateTimestamp(b, parent)
+}
+
+// CheckHeaders validates a chain of headers that starts on top of a known
+// block, as far as that is possible without the transactions. It returns the
+// height of the last header and whether the branch they form has more work
+// than the active chain.
+func (bc *BlockChain) CheckHeaders(headers []*block.Header) (int, bool, error) {
+	if len(headers) == 0 {
+		return 0, false, fmt.Errorf("no headers")
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	parent, ok := bc.nodes[headers[0].PreviousHash]
+	if !ok {
+		return 0, false, fmt.Errorf("headers do not connect to a known block: unknown parent %x", headers[0].PreviousHash)
+	}
+	if parent.invalid {
+		return 0, false, fmt.Errorf("headers extend invalid block %x", parent.hash)
+	}
+	for _, h := range headers {
+		b := &block.Block{Header: *h}
+		if err := bc.validateHeader(b, parent); err != nil {
+			return 0, false, err
+		}
+		n, ok := bc.nodes[b.Hash()]
+		if !ok {
+			n = newBlockNode(b, parent)
+		}
+		if n.invalid {
+			return 0, false, fmt.Errorf("header %x belongs to an invalid block", n.hash)
+		}
+		parent = n
+	}
+	return parent.height, parent.work.Cmp(bc.tip.work) > 0, nil
+}
+
+func (bc *BlockChain) validateGenesisBlock(b *block.Block) error {
+	if b.PreviousHash != [32]byte{} {
+		return rejectBlock(b, REJECT_PREVIOUS_HASH, "genesis block must not have a parent")
+	}
+	if hash := bc.genesis.Hash(); b.Hash() != hash {
+		return rejectBlock(b, REJECT_GENESIS, "genesis block does not match %x", hash)
+	}
+	if !b.VerifyMerkleRoot() {
+		return rejectBlock(b, REJECT_MERKLE_ROOT, "merkle root does not match transactions")
+	}
+	return nil
+}
+
+func validateTimestamp(b *block.Block, parent *blockNode) error {
+	mtp := medianTimePast(parent)
+	if b.Timestamp <= mtp {
+		return rejectBlock(b, REJECT_TIMESTAMP, "timestamp %d is not after median time past %d", b.Timestamp, mtp)
+	}
+	maxTime := time.Now().Add(MAX_FUTURE_BLOCK_TIME).UnixNano()
+	if b.Timestamp > maxTime {
+		return rejectBlock(b, REJECT_TIME_TOO_NEW, "timestamp %d is too far in the future", b.Timestamp)
+	}
+	return nil
+}
+
+func medianTimePast(n *blockNode) int64 {
+	timestamps := make([]int64, 0, MEDIAN_TIME_BLOCKS)
+	for ; n != nil && len(timestamps) < MEDIAN_TIME_BLOCKS; n = n.parent {
+		timestamps = append(timestamps, n.block.Timestamp)
+	}
+	return median(timestamps)
+}
+
+// MedianHeaderTime returns the median time past of the last header of
+// headers, which a header that follows it must be later than.
+func MedianHeaderTime(headers []*block.Header) int64 {
+	timestamps := make([]int64, 0, MEDIAN_TIME_BLOCKS)
+	for i := len(headers) - 1; i >= 0 && len(timestamps) < MEDIAN_TIME_BLOCKS; i-- {
+		timestamps = append(timestamps, headers[i].Timestamp)
+	}
+	return median(timestamps)
+}
+
+func median(timestamps []int64) int64 {
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+func (bc *BlockChain) validateTransactions(b *block.Block, height int) error {
+	if len(b.Transactions) == 0 || b.Transactions[0].SenderAddress != MINING_SENDER {
+		return rejectBlock(b, REJECT_COINBASE, "first transaction must be the coinbase")
+	}
+
+	var fees transaction.Amount
+	seen := make(map[[32]byte]struct{}, len(b.Transactions))
+	for i, t := range b.Transactions {
+		if _, ok := seen[t.Id]; ok {
+			return rejectBlock(b, REJECT_TRANSACTION, "duplicate transaction %s", t.HexHash())
+		}
+		seen[t.Id] = struct{}{}
+
+		if i > 0 && t.SenderAddress == MINING_SENDER {
+			return rejectBlock(b, REJECT_COINBASE, "transaction %s is a second coinbase", t.HexHash())
+		}
+		if err := bc.validateTransaction(t); err != nil {
+			return rejectBlock(b, REJECT_TRANSACTION, "transaction %s: %s", t.HexHash(), err)
+		}
+		var ok bool
+		if fees, ok = fees.Add(t.Fee); !ok {
+			return rejectBlock(b, REJECT_TRANSACTION, "fees exceed the maximum of %s", transaction.MAX_AMOUNT)
+		}
+	}
+	if err := validateCoinbase(b.Transactions[0], height, fees); err != nil {
+		return rejectBlock(b, REJECT_COINBASE, "%s", err)
+	}
+	return nil
+}
+
+func validateCoinbase(t *transaction.Transaction, height int, fees transaction.Amount) error {
+	if t.Fee != 0 {
+		return fmt.Errorf("coinbase must not pay a fee")
+	}
+	if t.Amount != MINING_REWARD+fees {
+		return fmt.Errorf("coinbase amount %s does not match reward %s and fees %s", t.Amount, MINING_REWARD, fees)
+	}
+	if len(t.Inputs) != 1 || !t.Inputs[0].IsNull() || t.Inputs[0].Index != uint32(height) {
+		return fmt.Errorf("coinbase must have a single null input committing to height %d", height)
+	}
+	if len(t.Outputs) > 0 {
+		return fmt.Errorf("coinbase must not have outputs")
+	}
+	return nil
+}
+
+// validateTransaction checks that the transaction id commits to its payload
+// and, for everything but the coinbase, that it is signed by the sender key
+// for this chain and has the shape the ledger model expects.
+func (bc *BlockChain) validateTransaction(t *transaction.Transaction) error {
+	h, err := t.SigningHash()
+	if err != nil {
+		return err
+	}
+	if h != t.Id {
+		return fmt.Errorf("id does not match payload hash %x", h)
+	}
+	if t.SenderAddress == MINING_SENDER {
+		return nil
+	}
+	if t.ChainId != bc.chainId {
+		return fmt.Errorf("chain id %q does not match %q", t.ChainId, bc.chainId)
+	}
+	if err := bc.ledger.validateTransaction(t); err != nil {
+		return err
+	}
+	return t.VerifySignature()
+}
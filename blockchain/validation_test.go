@@ -0,0 +1,222 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/storage"
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+func TestValidateBlock(t *testing.T) {
+	alice, bob, miner := newKey(t), newKey(t), newKey(t)
+	const funds = 10 * transaction.COIN
+	transfer := func(amount transaction.Amount, nonce uint64, chainId string) *transaction.Transaction {
+		return alice.sign(t, &transaction.Transaction{
+			ChainId:          chainId,
+			RecipientAddress: bob.address,
+			Amount:           amount,
+			Fee:              transaction.COIN / 10,
+			Nonce:            nonce,
+		})
+	}
+	// build assembles a block at height 1 with the given transactions,
+	// without checking the coinbase.
+	build := func(parent *block.Block, txs ...*transaction.Transaction) *block.Block {
+		b := block.New(0, parent.Hash(), parent.Target, txs)
+		b.Timestamp = parent.Timestamp + int64(time.Second)
+		return b
+	}
+
+	tests := []struct {
+		name  string
+		block func(parent *block.Block, tx *transaction.Transaction) *block.Block
+		code  RejectCode
+	}{
+		{
+			name: "valid",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return child(parent, 1, miner.address, tx)
+			},
+		},
+		{
+			name:  "known block",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block { return parent },
+			code:  REJECT_DUPLICATE,
+		},
+		{
+			name: "unknown parent",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				b := child(parent, 1, miner.address, tx)
+				b.PreviousHash = [32]byte{1}
+				return b
+			},
+			code: REJECT_ORPHAN,
+		},
+		{
+			name: "other target",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				b := child(parent, 1, miner.address, tx)
+				b.Target = 0x1e00ffff
+				return b
+			},
+			code: REJECT_DIFFICULTY,
+		},
+		{
+			name: "timestamp at median time past",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				b := child(parent, 1, miner.address, tx)
+				b.Timestamp = parent.Timestamp
+				return b
+			},
+			code: REJECT_TIMESTAMP,
+		},
+		{
+			name: "timestamp too far in the future",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				b := child(parent, 1, miner.address, tx)
+				b.Timestamp = time.Now().Add(MAX_FUTURE_BLOCK_TIME + time.Minute).UnixNano()
+				return b
+			},
+			code: REJECT_TIME_TOO_NEW,
+		},
+		{
+			name: "merkle root",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				b := child(parent, 1, miner.address, tx)
+				b.Transactions = b.Transactions[:1]
+				return b
+			},
+			code: REJECT_MERKLE_ROOT,
+		},
+		{
+			name:  "no coinbase",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block { return build(parent, tx) },
+			code:  REJECT_COINBASE,
+		},
+		{
+			name: "second coinbase",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return child(parent, 1, miner.address, NewCoinbaseTransaction(miner.address, 2, 0))
+			},
+			code: REJECT_COINBASE,
+		},
+		{
+			name: "coinbase pays more than the reward and fees",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return build(parent, NewCoinbaseTransaction(miner.address, 1, tx.Fee+1), tx)
+			},
+			code: REJECT_COINBASE,
+		},
+		{
+			name: "coinbase of another height",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return build(parent, NewCoinbaseTransaction(miner.address, 2, tx.Fee), tx)
+			},
+			code: REJECT_COINBASE,
+		},
+		{
+			name: "duplicate transaction",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return child(parent, 1, miner.address, tx, tx)
+			},
+			code: REJECT_TRANSACTION,
+		},
+		{
+			name: "transaction changed after signing",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				changed := *tx
+				changed.Amount++
+				return child(parent, 1, miner.address, &changed)
+			},
+			code: REJECT_TRANSACTION,
+		},
+		{
+			name: "transaction of another chain",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return child(parent, 1, miner.address, transfer(transaction.COIN, 1, "other"))
+			},
+			code: REJECT_TRANSACTION,
+		},
+		{
+			name: "more than the balance",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return child(parent, 1, miner.address, transfer(funds, 1, ""))
+			},
+			code: REJECT_BALANCE,
+		},
+		{
+			name: "nonce gap",
+			block: func(parent *block.Block, tx *transaction.Transaction) *block.Block {
+				return child(parent, 1, miner.address, transfer(transaction.COIN, 2, ""))
+			},
+			code: REJECT_NONCE,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newTestChain(t, LEDGER_ACCOUNT, Allocation{Address: alice.address, Amount: funds})
+			genesis := bc.LastBlock()
+			b := tt.block(genesis, transfer(transaction.COIN, 1, ""))
+			err := bc.CreateBlock(b)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bc.LastBlock().Hash() != b.Hash() {
+					t.Fatal("valid block is not the tip")
+				}
+				return
+			}
+			var blockErr *BlockError
+			if !errors.As(err, &blockErr) || blockErr.Code != tt.code {
+				t.Fatalf("CreateBlock = %v, want a rejection with %s", err, tt.code)
+			}
+			if bc.LastBlock().Hash() != genesis.Hash() {
+				t.Fatal("rejected block changed the tip")
+			}
+		})
+	}
+}
+
+// unsolved rejects the proof of work of every block.
+type unsolved struct{ trivial }
+
+func (unsolved) Verify(block.Block) bool { return false }
+
+func TestValidateBlockProofOfWork(t *testing.T) {
+	miner := newKey(t)
+	store, err := storage.Open(&storage.Config{Backend: storage.BACKEND_MEMORY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockChain(testConfig(LEDGER_ACCOUNT), store, unsolved{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+
+	err = bc.CreateBlock(child(bc.LastBlock(), 1, miner.address))
+	var blockErr *BlockError
+	if !errors.As(err, &blockErr) || blockErr.Code != REJECT_PROOF_OF_WORK {
+		t.Fatalf("CreateBlock = %v, want a rejection with %s", err, REJECT_PROOF_OF_WORK)
+	}
+}
+
+func TestRejectedBlockIsNotKept(t *testing.T) {
+	miner := newKey(t)
+	bc := newTestChain(t, LEDGER_ACCOUNT)
+	genesis := bc.LastBlock()
+	// the coinbase claims more than the reward
+	bad := block.New(0, genesis.Hash(), genesis.Target, []*transaction.Transaction{NewCoinbaseTransaction(miner.address, 1, 1)})
+	bad.Timestamp = genesis.Timestamp + int64(time.Second)
+	if err := bc.CreateBlock(bad); err == nil {
+		t.Fatal("block with an invalid coinbase was accepted")
+	}
+	var blockErr *BlockError
+	if err := bc.CreateBlock(child(bad, 2, miner.address)); !errors.As(err, &blockErr) || blockErr.Code != REJECT_ORPHAN {
+		t.Fatalf("CreateBlock on a rejected block = %v, want a rejection with %s", err, REJECT_ORPHAN)
+	}
+}
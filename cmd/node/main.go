@@ -3,14 +3,22 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
+	"github.com/fr13n8/go-blockchain/blockchain"
 	pb "github.com/fr13n8/go-blockchain/gen/node"
+	"github.com/fr13n8/go-blockchain/network"
 	"github.com/fr13n8/go-blockchain/network/discovery"
+	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
 	"github.com/fr13n8/go-blockchain/server"
+	"github.com/fr13n8/go-blockchain/storage"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -24,7 +32,7 @@ type Logs struct {
 }
 
 var (
-	srv            = server.NewServer()
+	srv            *server.Server
 	logsWidget     = widget.NewMultiLineEntry()
 	nodeClient     pb.NodeServiceClient
 	peerAddr       = ""
@@ -62,7 +70,81 @@ func listenBLockExplorer(port int, exit <-chan struct{}) {
 	srv.BlockExplorer.ShutdownGracefully()
 }
 
+// identityCommand prints, rotates or imports the node identity if one of the
+// flags asks for it, and reports whether it did.
+func identityCommand(path, keyType string, show, rotate bool, importFile string) bool {
+	var key crypto.PrivKey
+	var err error
+	switch {
+	case rotate:
+		key, err = network.RotateIdentity(path, keyType)
+	case importFile != "":
+		key, err = network.ImportIdentity(path, importFile)
+	case show:
+		key, err = network.LoadIdentity(path)
+	default:
+		return false
+	}
+	if err != nil {
+		log.Fatalf("[APP] Error while managing identity: %s", err.Error())
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		log.Fatalf("[APP] Error while deriving peer ID: %s", err.Error())
+	}
+	fmt.Printf("peer id:  %s\nkey type: %s\nfile:     %s\n", id, network.KeyTypeName(key), path)
+	return true
+}
+
 func main() {
+	cfg := server.NewConfig()
+	flag.StringVar(&cfg.Storage.DataDir, "datadir", storage.DefaultDataDir(), "directory for chain data")
+	flag.StringVar(&cfg.Storage.Backend, "storage", storage.BACKEND_BOLT, "storage backend (bolt or memory)")
+	flag.StringVar(&cfg.Chain.Ledger, "ledger", blockchain.LEDGER_ACCOUNT, "ledger model of a new chain (account or utxo)")
+	genesisFile := flag.String("genesis", "", "genesis specification file (the development network if empty)")
+	printGenesis := flag.Bool("print-genesis", false, "print the genesis block hash and exit")
+	flag.BoolVar(&cfg.DHT, "dht", true, "discover peers with a Kademlia DHT rendezvous")
+	flag.BoolVar(&cfg.MDNS, "mdns", true, "discover peers on the local network with mDNS")
+	flag.IntVar(&cfg.MinPeers, "min-peers", peer_manager.MIN_PEERS, "number of peers discovery dials until it is reached")
+	flag.IntVar(&cfg.MaxPeers, "max-peers", peer_manager.MAX_PEERS, "number of peers beyond which connections are closed")
+	flag.BoolVar(&cfg.GossipSub, "gossipsub", true, "propagate blocks and transactions with GossipSub (peer sessions are used otherwise)")
+	flag.StringVar(&cfg.IdentityKeyType, "identity-key-type", network.KEY_TYPE_ED25519, "key type of a new node identity (ed25519, secp256k1 or rsa)")
+	printIdentity := flag.Bool("print-identity", false, "print the peer ID of the node identity and exit")
+	rotateIdentity := flag.Bool("rotate-identity", false, "replace the node identity with a new key and exit")
+	importIdentity := flag.String("import-identity", "", "replace the node identity with the key in the given file and exit")
+	flag.Parse()
+
+	if identityCommand(network.IdentityPath(cfg.Storage.DataDir), cfg.IdentityKeyType, *printIdentity, *rotateIdentity, *importIdentity) {
+		return
+	}
+
+	if *genesisFile != "" {
+		genesis, err := blockchain.LoadGenesis(*genesisFile)
+		if err != nil {
+			log.Fatalf("[APP] Error while loading genesis: %s", err.Error())
+		}
+		cfg.Chain.Genesis = genesis
+	}
+	genesisHash, err := cfg.Chain.Genesis.Hash()
+	if err != nil {
+		log.Fatalf("[APP] Error while building genesis block: %s", err.Error())
+	}
+	if *printGenesis {
+		fmt.Printf("%x\n", genesisHash)
+		return
+	}
+	log.Printf("[APP] Chain %s, genesis block %x", cfg.Chain.Genesis.ChainId, genesisHash)
+
+	srv, err = server.NewServer(cfg)
+	if err != nil {
+		log.Fatalf("[APP] Error while starting node: %s", err.Error())
+	}
+	defer func() {
+		if err := srv.Close(); err != nil {
+			log.Printf("[APP] Error while closing chain storage: %s", err.Error())
+		}
+	}()
+
 	myApp := app.New()
 	w := myApp.NewWindow("Node")
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"flag"
 	"log"
 
@@ -10,13 +11,23 @@ import (
 func main() {
 	// get gateway from flag
 	gateway := flag.String("gateway", ":5050", "gateway address")
+	lightClient := flag.Bool("spv", false, "verify balances with block headers instead of trusting the node")
+	genesis := flag.String("genesis", "", "hex hash of the genesis block the light client accepts (the development network if empty)")
 	flag.Parse()
 
 	cfg := wallet.Config{
-		Port:       8080,
-		ServerName: "Wallet",
-		Host:       "0.0.0.0",
-		Gateway:    "0.0.0.0" + *gateway,
+		Port:        8080,
+		ServerName:  "Wallet",
+		Host:        "0.0.0.0",
+		Gateway:     "0.0.0.0" + *gateway,
+		LightClient: *lightClient,
+	}
+	if *genesis != "" {
+		hash, err := hex.DecodeString(*genesis)
+		if err != nil || len(hash) != len(cfg.GenesisHash) {
+			log.Fatalf("[WALLET] Invalid genesis hash %q", *genesis)
+		}
+		copy(cfg.GenesisHash[:], hash)
 	}
 	s := wallet.NewServer(&cfg)
 	log.Printf("[WALLET] Start wallet listen on port %d\n", 8080)
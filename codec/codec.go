@@ -0,0 +1,199 @@
+// Package codec implements the primitives of the canonical binary encoding of
+// headers, transactions and blocks. Hashes are computed over this encoding and
+// it is the format used on the wire and on disk.
+//
+// Integers of a fixed width are big-endian. Lengths and counts are unsigned
+// varints in their shortest form. Every top-level encoding starts with the
+// VERSION byte it was written with.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const VERSION = 1
+
+var (
+	ErrUnexpectedEnd = errors.New("unexpected end of data")
+	ErrTrailingData  = errors.New("trailing data")
+)
+
+type Writer struct {
+	buf []byte
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+// Version writes the VERSION byte.
+func (w *Writer) Version() {
+	w.Uint8(VERSION)
+}
+
+func (w *Writer) Uint8(v uint8) {
+	w.buf = append(w.buf, v)
+}
+
+func (w *Writer) Uint32(v uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *Writer) Uint64(v uint64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, v)
+}
+
+func (w *Writer) Int64(v int64) {
+	w.Uint64(uint64(v))
+}
+
+func (w *Writer) Uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+// Fixed writes b as is. The reader has to know its length.
+func (w *Writer) Fixed(b []byte) {
+	w.buf = append(w.buf, b...)
+}
+
+// VarBytes writes b prefixed with its length.
+func (w *Writer) VarBytes(b []byte) {
+	w.Uvarint(uint64(len(b)))
+	w.Fixed(b)
+}
+
+func (w *Writer) String(s string) {
+	w.Uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// Reader decodes data written by a Writer. The first error is kept and every
+// later read returns zero values, so that it only has to be checked once with
+// Err or Finish.
+type Reader struct {
+	data []byte
+	err  error
+}
+
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data}
+}
+
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Finish returns the first error of the reader, or ErrTrailingData if not all
+// of the data has been read.
+func (r *Reader) Finish() error {
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("%w: %d bytes", ErrTrailingData, len(r.data))
+	}
+	return r.err
+}
+
+func (r *Reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.fail(ErrUnexpectedEnd)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// Version reads a version byte and fails unless it is VERSION.
+func (r *Reader) Version() {
+	if v := r.Uint8(); r.err == nil && v != VERSION {
+		r.fail(fmt.Errorf("unsupported encoding version %d", v))
+	}
+}
+
+func (r *Reader) Uint8() uint8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *Reader) Uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *Reader) Uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *Reader) Int64() int64 {
+	return int64(r.Uint64())
+}
+
+func (r *Reader) Uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail(fmt.Errorf("invalid varint"))
+		return 0
+	}
+	if n != len(binary.AppendUvarint(nil, v)) {
+		r.fail(fmt.Errorf("non-canonical varint"))
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// Len reads a length or count of items that take at least min bytes each and
+// fails if the remaining data cannot hold them.
+func (r *Reader) Len(min int) int {
+	n := r.Uvarint()
+	if r.err != nil {
+		return 0
+	}
+	if min < 1 {
+		min = 1
+	}
+	if n > uint64(len(r.data)/min) {
+		r.fail(ErrUnexpectedEnd)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *Reader) Fixed(n int) []byte {
+	return r.next(n)
+}
+
+func (r *Reader) VarBytes() []byte {
+	return r.next(r.Len(1))
+}
+
+func (r *Reader) String() string {
+	return string(r.VarBytes())
+}
@@ -0,0 +1,141 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	w := NewWriter()
+	w.Version()
+	w.Uint8(0xab)
+	w.Uint32(0xdeadbeef)
+	w.Uint64(1<<63 + 7)
+	w.Int64(-42)
+	w.Uvarint(0)
+	w.Uvarint(300)
+	w.Fixed([]byte{1, 2, 3})
+	w.VarBytes([]byte("payload"))
+	w.VarBytes(nil)
+	w.String("go-blockchain")
+
+	r := NewReader(w.Bytes())
+	r.Version()
+	if v := r.Uint8(); v != 0xab {
+		t.Errorf("Uint8 = %#x, want 0xab", v)
+	}
+	if v := r.Uint32(); v != 0xdeadbeef {
+		t.Errorf("Uint32 = %#x, want 0xdeadbeef", v)
+	}
+	if v := r.Uint64(); v != 1<<63+7 {
+		t.Errorf("Uint64 = %d, want %d", v, uint64(1<<63+7))
+	}
+	if v := r.Int64(); v != -42 {
+		t.Errorf("Int64 = %d, want -42", v)
+	}
+	if v := r.Uvarint(); v != 0 {
+		t.Errorf("Uvarint = %d, want 0", v)
+	}
+	if v := r.Uvarint(); v != 300 {
+		t.Errorf("Uvarint = %d, want 300", v)
+	}
+	if v := r.Fixed(3); !bytes.Equal(v, []byte{1, 2, 3}) {
+		t.Errorf("Fixed = %x, want 010203", v)
+	}
+	if v := r.VarBytes(); string(v) != "payload" {
+		t.Errorf("VarBytes = %q, want %q", v, "payload")
+	}
+	if v := r.VarBytes(); len(v) != 0 {
+		t.Errorf("VarBytes = %x, want empty", v)
+	}
+	if v := r.String(); v != "go-blockchain" {
+		t.Errorf("String = %q, want %q", v, "go-blockchain")
+	}
+	if err := r.Finish(); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+}
+
+func TestBigEndian(t *testing.T) {
+	w := NewWriter()
+	w.Uint32(0x01020304)
+	if got, want := w.Bytes(), []byte{1, 2, 3, 4}; !bytes.Equal(got, want) {
+		t.Fatalf("Uint32 encoding = %x, want %x", got, want)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		read func(r *Reader)
+		want error
+	}{
+		{
+			name: "short fixed integer",
+			data: []byte{0, 0, 1},
+			read: func(r *Reader) { r.Uint32() },
+			want: ErrUnexpectedEnd,
+		},
+		{
+			name: "trailing data",
+			data: []byte{1, 2},
+			read: func(r *Reader) { r.Uint8() },
+			want: ErrTrailingData,
+		},
+		{
+			name: "length beyond the data",
+			data: []byte{5, 'a', 'b'},
+			read: func(r *Reader) { r.VarBytes() },
+			want: ErrUnexpectedEnd,
+		},
+		{
+			name: "count of items beyond the data",
+			data: []byte{3, 0, 0, 0, 0},
+			read: func(r *Reader) { r.Len(2) },
+			want: ErrUnexpectedEnd,
+		},
+		{
+			name: "non-canonical varint",
+			data: []byte{0x80, 0x00},
+			read: func(r *Reader) { r.Uvarint() },
+		},
+		{
+			name: "truncated varint",
+			data: []byte{0x80},
+			read: func(r *Reader) { r.Uvarint() },
+		},
+		{
+			name: "unsupported version",
+			data: []byte{VERSION + 1},
+			read: func(r *Reader) { r.Version() },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(tt.data)
+			tt.read(r)
+			err := r.Finish()
+			if err == nil {
+				t.Fatal("Finish succeeded, want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Finish = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderKeepsFirstError(t *testing.T) {
+	r := NewReader([]byte{1})
+	if v := r.Uint64(); v != 0 {
+		t.Errorf("Uint64 = %d, want 0 on a short read", v)
+	}
+	if v := r.Uint8(); v != 0 {
+		t.Errorf("Uint8 = %d after an error, want 0", v)
+	}
+	if err := r.Err(); !errors.Is(err, ErrUnexpectedEnd) {
+		t.Fatalf("Err = %v, want %v", err, ErrUnexpectedEnd)
+	}
+}
@@ -32,6 +32,13 @@ type NodeServiceClient interface {
 	StopMining(ctx context.Context, in *StopMiningRequest, opts ...grpc.CallOption) (*StopMiningResponse, error)
 	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error)
 	GetPeers(ctx context.Context, in *GetPeersRequest, opts ...grpc.CallOption) (*GetPeersResponse, error)
+	GetUnspentOutputs(ctx context.Context, in *GetUnspentOutputsRequest, opts ...grpc.CallOption) (*GetUnspentOutputsResponse, error)
+	GetNonce(ctx context.Context, in *GetNonceRequest, opts ...grpc.CallOption) (*GetNonceResponse, error)
+	EstimateFee(ctx context.Context, in *EstimateFeeRequest, opts ...grpc.CallOption) (*EstimateFeeResponse, error)
+	GetTransactionProof(ctx context.Context, in *GetTransactionProofRequest, opts ...grpc.CallOption) (*GetTransactionProofResponse, error)
+	GetHeaders(ctx context.Context, in *GetHeadersRequest, opts ...grpc.CallOption) (*GetHeadersResponse, error)
+	GetAddressTransactions(ctx context.Context, in *GetAddressTransactionsRequest, opts ...grpc.CallOption) (*GetAddressTransactionsResponse, error)
+	GetSyncStatus(ctx context.Context, in *GetSyncStatusRequest, opts ...grpc.CallOption) (*GetSyncStatusResponse, error)
 }
 
 type nodeServiceClient struct {
@@ -132,6 +139,69 @@ func (c *nodeServiceClient) GetPeers(ctx context.Context, in *GetPeersRequest, o
 	return out, nil
 }
 
+func (c *nodeServiceClient) GetUnspentOutputs(ctx context.Context, in *GetUnspentOutputsRequest, opts ...grpc.CallOption) (*GetUnspentOutputsResponse, error) {
+	out := new(GetUnspentOutputsResponse)
+	err := c.cc.Invoke(ctx, "/node.NodeService/GetUnspentOutputs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) GetNonce(ctx context.Context, in *GetNonceRequest, opts ...grpc.CallOption) (*GetNonceResponse, error) {
+	out := new(GetNonceResponse)
+	err := c.cc.Invoke(ctx, "/node.NodeService/GetNonce", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) EstimateFee(ctx context.Context, in *EstimateFeeRequest, opts ...grpc.CallOption) (*EstimateFeeResponse, error) {
+	out := new(EstimateFeeResponse)
+	err := c.cc.Invoke(ctx, "/node.NodeService/EstimateFee", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) GetTransactionProof(ctx context.Context, in *GetTransactionProofRequest, opts ...grpc.CallOption) (*GetTransactionProofResponse, error) {
+	out := new(GetTransactionProofResponse)
+	err := c.cc.Invoke(ctx, "/node.NodeService/GetTransactionProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) GetHeaders(ctx context.Context, in *GetHeadersRequest, opts ...grpc.CallOption) (*GetHeadersResponse, error) {
+	out := new(GetHeadersResponse)
+	err := c.cc.Invoke(ctx, "/node.NodeService/GetHeaders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) GetAddressTransactions(ctx context.Context, in *GetAddressTransactionsRequest, opts ...grpc.CallOption) (*GetAddressTransactionsResponse, error) {
+	out := new(GetAddressTransactionsResponse)
+	err := c.cc.Invoke(ctx, "/node.NodeService/GetAddressTransactions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) GetSyncStatus(ctx context.Context, in *GetSyncStatusRequest, opts ...grpc.CallOption) (*GetSyncStatusResponse, error) {
+	out := new(GetSyncStatusResponse)
+	err := c.cc.Invoke(ctx, "/node.NodeService/GetSyncStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NodeServiceServer is the server API for NodeService service.
 // All implementations must embed UnimplementedNodeServiceServer
 // for forward compatibility
@@ -146,6 +216,13 @@ type NodeServiceServer interface {
 	StopMining(context.Context, *StopMiningRequest) (*StopMiningResponse, error)
 	GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error)
 	GetPeers(context.Context, *GetPeersRequest) (*GetPeersResponse, error)
+	GetUnspentOutputs(context.Context, *GetUnspentOutputsRequest) (*GetUnspentOutputsResponse, error)
+	GetNonce(context.Context, *GetNonceRequest) (*GetNonceResponse, error)
+	EstimateFee(context.Context, *EstimateFeeRequest) (*EstimateFeeResponse, error)
+	GetTransactionProof(context.Context, *GetTransactionProofRequest) (*GetTransactionProofResponse, error)
+	GetHeaders(context.Context, *GetHeadersRequest) (*GetHeadersResponse, error)
+	GetAddressTransactions(context.Context, *GetAddressTransactionsRequest) (*GetAddressTransactionsResponse, error)
+	GetSyncStatus(context.Context, *GetSyncStatusRequest) (*GetSyncStatusResponse, error)
 	mustEmbedUnimplementedNodeServiceServer()
 }
 
@@ -183,6 +260,27 @@ func (UnimplementedNodeServiceServer) GetBalance(context.Context, *GetBalanceReq
 func (UnimplementedNodeServiceServer) GetPeers(context.Context, *GetPeersRequest) (*GetPeersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetPeers not implemented")
 }
+func (UnimplementedNodeServiceServer) GetUnspentOutputs(context.Context, *GetUnspentOutputsRequest) (*GetUnspentOutputsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUnspentOutputs not implemented")
+}
+func (UnimplementedNodeServiceServer) GetNonce(context.Context, *GetNonceRequest) (*GetNonceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNonce not implemented")
+}
+func (UnimplementedNodeServiceServer) EstimateFee(context.Context, *EstimateFeeRequest) (*EstimateFeeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EstimateFee not implemented")
+}
+func (UnimplementedNodeServiceServer) GetTransactionProof(context.Context, *GetTransactionProofRequest) (*GetTransactionProofResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransactionProof not implemented")
+}
+func (UnimplementedNodeServiceServer) GetHeaders(context.Context, *GetHeadersRequest) (*GetHeadersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHeaders not implemented")
+}
+func (UnimplementedNodeServiceServer) GetAddressTransactions(context.Context, *GetAddressTransactionsRequest) (*GetAddressTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAddressTransactions not implemented")
+}
+func (UnimplementedNodeServiceServer) GetSyncStatus(context.Context, *GetSyncStatusRequest) (*GetSyncStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSyncStatus not implemented")
+}
 func (UnimplementedNodeServiceServer) mustEmbedUnimplementedNodeServiceServer() {}
 
 // UnsafeNodeServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -376,6 +474,132 @@ func _NodeService_GetPeers_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _NodeService_GetUnspentOutputs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUnspentOutputsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetUnspentOutputs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/node.NodeService/GetUnspentOutputs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetUnspentOutputs(ctx, req.(*GetUnspentOutputsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_GetNonce_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNonceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetNonce(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/node.NodeService/GetNonce",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetNonce(ctx, req.(*GetNonceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_EstimateFee_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EstimateFeeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).EstimateFee(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/node.NodeService/EstimateFee",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).EstimateFee(ctx, req.(*EstimateFeeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_GetTransactionProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetTransactionProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/node.NodeService/GetTransactionProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetTransactionProof(ctx, req.(*GetTransactionProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_GetHeaders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHeadersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetHeaders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/node.NodeService/GetHeaders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetHeaders(ctx, req.(*GetHeadersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_GetAddressTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAddressTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetAddressTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/node.NodeService/GetAddressTransactions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetAddressTransactions(ctx, req.(*GetAddressTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_GetSyncStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSyncStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).GetSyncStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/node.NodeService/GetSyncStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).GetSyncStatus(ctx, req.(*GetSyncStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // NodeService_ServiceDesc is the grpc.ServiceDesc for NodeService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -423,6 +647,34 @@ var NodeService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetPeers",
 			Handler:    _NodeService_GetPeers_Handler,
 		},
+		{
+			MethodName: "GetUnspentOutputs",
+			Handler:    _NodeService_GetUnspentOutputs_Handler,
+		},
+		{
+			MethodName: "GetNonce",
+			Handler:    _NodeService_GetNonce_Handler,
+		},
+		{
+			MethodName: "EstimateFee",
+			Handler:    _NodeService_EstimateFee_Handler,
+		},
+		{
+			MethodName: "GetTransactionProof",
+			Handler:    _NodeService_GetTransactionProof_Handler,
+		},
+		{
+			MethodName: "GetHeaders",
+			Handler:    _NodeService_GetHeaders_Handler,
+		},
+		{
+			MethodName: "GetAddressTransactions",
+			Handler:    _NodeService_GetAddressTransactions_Handler,
+		},
+		{
+			MethodName: "GetSyncStatus",
+			Handler:    _NodeService_GetSyncStatus_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "node/node.proto",
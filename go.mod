@@ -7,7 +7,9 @@ require (
 	github.com/a-h/templ v0.2.476
 	github.com/btcsuite/btcutil v1.0.2
 	github.com/gofiber/fiber/v2 v2.51.0
+	github.com/libp2p/go-libp2p-pubsub v0.10.0
 	github.com/pkg/errors v0.9.1
+	go.etcd.io/bbolt v1.3.8
 	google.golang.org/grpc v1.53.0
 	google.golang.org/protobuf v1.31.0
 )
@@ -18,7 +20,8 @@ require (
 	github.com/google/uuid v1.4.0 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/hashicorp/golang-lru v0.5.4 // indirect
+	github.com/hashicorp/golang-lru v0.5.4
+	github.com/hashicorp/golang-lru/v2 v2.0.5 // indirect
 	github.com/ipfs/boxo v0.16.0 // indirect
 	github.com/ipfs/go-datastore v0.6.0 // indirect
 	github.com/ipfs/go-log v1.0.5 // indirect
@@ -26,6 +29,7 @@ require (
 	github.com/jbenet/goprocess v0.1.4 // indirect
 	github.com/libp2p/go-libp2p-kbucket v0.6.3 // indirect
 	github.com/libp2p/go-libp2p-record v0.2.0 // indirect
+	github.com/libp2p/zeroconf/v2 v2.2.0 // indirect
 	github.com/matttproud/golang_protobuf_extensions/v2 v2.0.0 // indirect
 	github.com/opentracing/opentracing-go v1.2.0 // indirect
 	github.com/polydawn/refmt v0.89.0 // indirect
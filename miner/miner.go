@@ -9,7 +9,7 @@ import (
 )
 
 const (
-	MINING_REWARD = 1.0
+	MINING_REWARD = blockchain.MINING_REWARD
 	MINING_TIMER  = 20
 )
 
@@ -17,6 +17,7 @@ type Miner struct {
 	minerAddress string
 	solver       block.Solver
 	bc           *blockchain.BlockChain
+	subscribers  []func(*block.Block)
 }
 
 func NewMiner(solver block.Solver, bc *blockchain.BlockChain) *Miner {
@@ -27,15 +28,17 @@ func (m *Miner) SetMinerAddress(address string) {
 	m.minerAddress = address
 }
 
+// Subscribe registers fn to be called with every block the miner has added to
+// the chain, so that it can be announced.
+func (m *Miner) Subscribe(fn func(*block.Block)) {
+	m.subscribers = append(m.subscribers, fn)
+}
+
 func (m *Miner) GetBlockForMine() *block.Block {
 	if m.bc.TransactionPool.Size() == 0 {
 		return nil
 	}
-	m.bc.AddTransaction(blockchain.MINING_SENDER, m.minerAddress, MINING_REWARD, nil, nil)
-	transactions := m.bc.GetTransactionPool()
-	previousHash := m.bc.LastBlock().Hash()
-
-	return block.New(0, previousHash, transactions)
+	return m.bc.BlockTemplate(m.minerAddress)
 }
 
 func (m *Miner) Mine() bool {
@@ -46,8 +49,14 @@ func (m *Miner) Mine() bool {
 
 	log.Println("[NODE] Mining new block")
 	if m.ProofOfWork(b) {
-		m.bc.CreateBlock(b)
+		if err := m.bc.CreateBlock(b); err != nil {
+			log.Printf("[NODE] Adding mined block %s failed: %s", b.HexHash(), err)
+			return false
+		}
 		log.Printf("[NODE] Mining block %s success", b.HexHash())
+		for _, fn := range m.subscribers {
+			fn(b)
+		}
 		return true
 	}
 
@@ -2,14 +2,13 @@ package discovery
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
-	"github.com/fr13n8/go-blockchain/network/grpc"
 	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
-	"github.com/libp2p/go-libp2p/core/network"
-	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	drouting "github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
 
@@ -19,13 +18,30 @@ import (
 	"github.com/multiformats/go-multiaddr"
 )
 
+const (
+	PEERS_REPORT_INTERVAL = time.Second
+
+	// DISCOVERY_INTERVAL is how often the rendezvous is searched for peers
+	// while there are fewer than the target, and DISCOVERY_IDLE_INTERVAL how
+	// often once there are enough.
+	DISCOVERY_INTERVAL      = 10 * time.Second
+	DISCOVERY_IDLE_INTERVAL = 5 * time.Minute
+)
+
+// Service finds peers with a Kademlia DHT rendezvous, mDNS on the local
+// network or both, and has the peer manager connect to them until there are
+// as many peers as the target.
 type Service struct {
-	pm *peer_manager.PeerManager
+	pm     *peer_manager.PeerManager
+	target int
+	host   host.Host
+	mdns   mdns.Service
 }
 
-func NewDiscoveryService(pm *peer_manager.PeerManager) *Service {
+func NewDiscoveryService(pm *peer_manager.PeerManager, targetPeers int) *Service {
 	return &Service{
-		pm: pm,
+		pm:     pm,
+		target: targetPeers,
 	}
 }
 
@@ -77,45 +93,116 @@ func (ds *Service) NewDHT(ctx context.Context, h host.Host, bootstrapPeers []mul
 	return kdht, nil
 }
 
-func (ds *Service) Discover(ctx context.Context, h host.Host, dht *dht.IpfsDHT, rendezvous string, gr *grpc.Stream, protocolId string, peerAddress chan<- []string) {
+// Discover advertises the node at the rendezvous and dials the peers found
+// there until ctx is done. The rendezvous is searched every
+// DISCOVERY_INTERVAL while there are fewer peers than the target, and every
+// DISCOVERY_IDLE_INTERVAL once there are enough.
+func (ds *Service) Discover(ctx context.Context, h host.Host, dht *dht.IpfsDHT, rendezvous string) {
 	var routingDiscovery = drouting.NewRoutingDiscovery(dht)
 
 	dutil.Advertise(ctx, routingDiscovery, rendezvous)
 
-	ticker := time.NewTicker(time.Second * 1)
-	defer ticker.Stop()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			peers, err := routingDiscovery.FindPeers(ctx, rendezvous)
-			if err != nil {
-				log.Printf("Error finding peers: %v\n", err)
-				continue
+		case <-timer.C:
+		}
+		if missing := ds.target - ds.pm.PeerCount(); missing > 0 {
+			if err := ds.findPeers(ctx, h, routingDiscovery, rendezvous, missing); err != nil {
+				log.Printf("[NETWORK] Error while finding peers: %v\n", err)
 			}
+		}
+		interval := DISCOVERY_INTERVAL
+		if ds.pm.PeerCount() >= ds.target {
+			interval = DISCOVERY_IDLE_INTERVAL
+		}
+		timer.Reset(interval)
+	}
+}
 
-			for p := range peers {
-				if p.ID == h.ID() {
-					continue
-				}
-
-				myPeers := make([]string, 0, len(h.Network().Peers()))
-				for _, p := range h.Network().Peers() {
-					addrs := h.Network().Peerstore().PeerInfo(p).Addrs
-					myPeers = append(myPeers, addrs[0].String()+" <=> "+addrs[1].String())
-				}
-				peerAddress <- myPeers
-
-				if h.Network().Connectedness(p.ID) != network.Connected {
-					_, err := h.NewStream(ctx, p.ID, protocol.ID(protocolId))
-					if err != nil {
-						log.Println("Connection failed:", err)
-						continue
-					}
-				}
-			}
+// findPeers dials up to n of the peers found at the rendezvous. Peers that
+// are connected, or that failed to be dialed recently, are skipped by the
+// peer manager.
+func (ds *Service) findPeers(ctx context.Context, h host.Host, routingDiscovery *drouting.RoutingDiscovery, rendezvous string, n int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	peers, err := routingDiscovery.FindPeers(ctx, rendezvous)
+	if err != nil {
+		return err
+	}
+	for p := range peers {
+		if p.ID == h.ID() || len(p.Addrs) == 0 {
+			continue
 		}
+		if ds.pm.Connect(p) {
+			n--
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// StartMDNS advertises the node on the local network under serviceName and
+// connects to the nodes that advertise the same name, so that nodes on one
+// machine or LAN find each other without a boot node.
+func (ds *Service) StartMDNS(h host.Host, serviceName string) error {
+	ds.host = h
+	ds.mdns = mdns.NewMdnsService(h, serviceName, ds)
+	if err := ds.mdns.Start(); err != nil {
+		return fmt.Errorf("start mdns: %w", err)
+	}
+	return nil
+}
+
+// HandlePeerFound is called by mDNS for every node it finds, including this
+// one. The node is dialed while there are fewer peers than the target.
+func (ds *Service) HandlePeerFound(p peer.AddrInfo) {
+	if p.ID == ds.host.ID() {
+		return
+	}
+	if _, ok := ds.pm.Session(p.ID); ok || ds.pm.PeerCount() >= ds.target {
+		return
+	}
+	if ds.pm.Connect(p) {
+		log.Printf("[NETWORK] Found peer %s with mDNS\n", p.ID)
+	}
+}
+
+// ReportPeers sends the local and remote addresses of the connections with
+// peers to peerAddress every PEERS_REPORT_INTERVAL until ctx is done.
+func (ds *Service) ReportPeers(ctx context.Context, h host.Host, peerAddress chan<- []string) {
+	ticker := time.NewTicker(PEERS_REPORT_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		conns := h.Network().Conns()
+		myPeers := make([]string, 0, len(conns))
+		for _, c := range conns {
+			myPeers = append(myPeers, c.LocalMultiaddr().String()+" <=> "+c.RemoteMultiaddr().String())
+		}
+		select {
+		case peerAddress <- myPeers:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ds *Service) Close() error {
+	if ds.mdns == nil {
+		return nil
 	}
+	return ds.mdns.Close()
 }
@@ -0,0 +1,125 @@
+package network
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+
+	"github.com/fr13n8/go-blockchain/blockchain"
+	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	TOPIC_TRANSACTIONS = "transactions"
+	TOPIC_BLOCKS       = "blocks"
+
+	// MAX_GOSSIP_MESSAGE_SIZE leaves room for the envelope of a block of the
+	// largest size.
+	MAX_GOSSIP_MESSAGE_SIZE = blockchain.MAX_BLOCK_SIZE + 64*1024
+)
+
+// gossip propagates blocks and transactions over GossipSub, with a topic for
+// each on every chain.
+type gossip struct {
+	ps     *pubsub.PubSub
+	topics map[string]*pubsub.Topic
+}
+
+// topicName scopes a topic to a chain, so that nodes on other networks do not
+// join its mesh.
+func topicName(chainId, topic string) string {
+	return fmt.Sprintf("/go-blockchain/%s/%s", chainId, topic)
+}
+
+// gossipMessageID identifies messages by the hash of their data, like the
+// seen caches, so that a block or transaction is delivered once whoever
+// publishes it.
+func gossipMessageID(msg *pubsub_pb.Message) string {
+	hash := sha256.Sum256(msg.Data)
+	return string(hash[:])
+}
+
+// StartGossip joins the GossipSub topics of the chain over h until ctx is
+// done. Messages are validated before they are forwarded: invalid ones are
+// rejected and count against the peer they came from.
+func (r *Relay) StartGossip(ctx context.Context, h host.Host) error {
+	ps, err := pubsub.NewGossipSub(ctx, h,
+		pubsub.WithMessageIdFn(gossipMessageID),
+		pubsub.WithMaxMessageSize(MAX_GOSSIP_MESSAGE_SIZE),
+	)
+	if err != nil {
+		return fmt.Errorf("create gossipsub: %w", err)
+	}
+
+	g := &gossip{ps: ps, topics: make(map[string]*pubsub.Topic)}
+	receivers := map[string]func([]byte, peer.ID, bool) (pubsub.ValidationResult, error){
+		TOPIC_TRANSACTIONS: r.receiveTransaction,
+		TOPIC_BLOCKS:       r.receiveBlock,
+	}
+	for topic, receive := range receivers {
+		name := topicName(r.bc.ChainId(), topic)
+		if err := ps.RegisterTopicValidator(name, validator(h.ID(), r.pm, topic, receive)); err != nil {
+			return fmt.Errorf("register validator of %s: %w", name, err)
+		}
+		t, err := ps.Join(name)
+		if err != nil {
+			return fmt.Errorf("join %s: %w", name, err)
+		}
+		sub, err := t.Subscribe()
+		if err != nil {
+			return fmt.Errorf("subscribe to %s: %w", name, err)
+		}
+		go drain(ctx, sub)
+		g.topics[topic] = t
+	}
+
+	r.mux.Lock()
+	r.gossip = g
+	r.mux.Unlock()
+	log.Println("[NETWORK] Propagating blocks and transactions with GossipSub")
+	return nil
+}
+
+func (r *Relay) getGossip() *gossip {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.gossip
+}
+
+// validator processes the messages of a topic as they are validated, so that
+// only the ones this node accepts are forwarded. Messages published by this
+// node were processed before.
+func validator(self peer.ID, pm *peer_manager.PeerManager, topic string, receive func([]byte, peer.ID, bool) (pubsub.ValidationResult, error)) pubsub.ValidatorEx {
+	return func(_ context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		if from == self {
+			return pubsub.ValidationAccept
+		}
+		result, err := receive(msg.Data, from, false)
+		if err != nil {
+			pm.Penalize(from, peer_manager.PENALTY_INVALID_MESSAGE, fmt.Sprintf("%s: %s", topic, err))
+		}
+		return result
+	}
+}
+
+// drain reads the messages of a subscription, which have been processed by
+// the validator already.
+func drain(ctx context.Context, sub *pubsub.Subscription) {
+	defer sub.Cancel()
+	for {
+		if _, err := sub.Next(ctx); err != nil {
+			return
+		}
+	}
+}
+
+func (g *gossip) publish(topic string, data []byte) {
+	if err := g.topics[topic].Publish(context.Background(), data); err != nil {
+		log.Printf("[NETWORK] Error while publishing to %s: %v\n", topic, err)
+	}
+}
@@ -60,6 +60,19 @@ func interceptor(
 	)
 }
 
+// PeerIDFromContext returns the libp2p peer a server stream or call came from.
+func PeerIDFromContext(ctx context.Context) (peer.ID, bool) {
+	contextPeer, ok := grpcPeer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	addr, ok := contextPeer.Addr.(*wrapLibp2pAddr)
+	if !ok {
+		return "", false
+	}
+	return addr.id, true
+}
+
 func (g *Stream) Client(stream network.Stream) *grpc.ClientConn {
 	return WrapClient(stream)
 }
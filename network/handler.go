@@ -1,55 +1,120 @@
 package network
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"slices"
 
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/blockchain"
 	pb "github.com/fr13n8/go-blockchain/gen/peer"
+	gr "github.com/fr13n8/go-blockchain/network/grpc"
 	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
 )
 
 type PeerHandler struct {
 	pb.UnimplementedPeerServiceServer
-	pm *peer_manager.PeerManager
+	bc    *blockchain.BlockChain
+	pm    *peer_manager.PeerManager
+	relay *Relay
 }
 
-func NewPeerHandler(service *peer_manager.PeerManager) *PeerHandler {
+func NewPeerHandler(bc *blockchain.BlockChain, service *peer_manager.PeerManager, relay *Relay) *PeerHandler {
 	return &PeerHandler{
-		pm: service,
+		bc:    bc,
+		pm:    service,
+		relay: relay,
 	}
 }
 
+// Message serves a message stream opened by a peer as its session.
 func (h *PeerHandler) Message(serverStream pb.PeerService_MessageServer) error {
-	for {
-		msg, err := serverStream.Recv()
+	id, ok := gr.PeerIDFromContext(serverStream.Context())
+	if !ok {
+		return errors.New("failed to get peer from context")
+	}
+	err := h.pm.Serve(serverStream.Context(), id, serverStream, false)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Handshake returns the handshake this node opens every session with.
+func (h *PeerHandler) Handshake() *peer_manager.Handshake {
+	features := FEATURES
+	if h.relay.getGossip() != nil {
+		features = append(slices.Clone(FEATURES), FEATURE_GOSSIPSUB)
+	}
+	hash, height, _ := h.bc.Tip()
+	return &peer_manager.Handshake{
+		ProtocolVersion: peer_manager.PROTOCOL_VERSION,
+		ChainId:         h.bc.ChainId(),
+		GenesisHash:     h.bc.GenesisHash(),
+		BestHeight:      uint64(height),
+		BestHash:        hash,
+		UserAgent:       USER_AGENT,
+		Features:        features,
+	}
+}
+
+// Handle processes a message received in a session, whichever side opened
+// it.
+func (h *PeerHandler) Handle(s *peer_manager.Session, msg *pb.MessageBody) error {
+	switch msg.Type {
+	case messageGetStatus, messageGetHeaders, messageGetBlocks:
+		reply, err := h.reply(msg)
 		if err != nil {
 			return err
 		}
-		if err == io.EOF {
-			return nil
+		return s.Send(reply)
+	case messageAddTx:
+		if err := h.relay.handleTransaction(msg.Data, s.ID); err != nil {
+			return fmt.Errorf("add_tx: %w", err)
+		}
+	case messageAddBlock:
+		if err := h.relay.handleBlock(msg.Data, s.ID); err != nil {
+			return fmt.Errorf("add_block: %w", err)
+		}
+	}
+	return nil
+}
+
+// reply answers the requests of a syncing peer.
+func (h *PeerHandler) reply(msg *pb.MessageBody) (*pb.MessageBody, error) {
+	switch msg.Type {
+	case messageGetStatus:
+		hash, height, work := h.bc.Tip()
+		return newStatusMessage(&Status{
+			GenesisHash: h.bc.GenesisHash(),
+			Height:      uint64(height),
+			BestHash:    hash,
+			Work:        work,
+		}), nil
+	case messageGetHeaders:
+		locator, max, err := decodeGetHeaders(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		return newHeadersMessage(h.bc.HeadersAfter(locator, int(max)))
+	case messageGetBlocks:
+		hashes, err := decodeGetBlocks(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if len(hashes) > MAX_BLOCKS_PER_REQUEST {
+			return nil, fmt.Errorf("get_blocks asks for %d blocks, at most %d are allowed", len(hashes), MAX_BLOCKS_PER_REQUEST)
 		}
-		// ctx := serverStream.Context()
-		switch msg.Type {
-		case messageAddTx:
-			//var tx transaction.Request
-			//if err := json.Unmarshal(msg.Data, &tx); err != nil {
-			//	return errors.Wrap(err, "unmarshal transaction")
-			//}
-			//publicKey := utils.PublicKeyFromString(tx.SenderPublicKey)
-			//signature := utils.SignatureFromString(tx.Signature)
-			//bc := h.ns.Bc
-			//isCreated := bc.CreateTransaction(tx.SenderAddress, tx.RecipientAddress, tx.Amount, publicKey, signature)
-			//if !isCreated {
-			//	return fmt.Errorf("transaction not created")
-			//}
-			//h.ns.PeerManager.BroadcastMessage(ctx, msg)
-		case messageAddBlock:
-			//var b block.Block
-			//if err := json.Unmarshal(msg.Data, &b); err != nil {
-			//	return errors.Wrap(err, "unmarshal block")
-			//}
-			//bc := h.ns.Bc
-			//bc.CreateBlock(&b)
-			//h.ns.PeerManager.BroadcastMessage(ctx, msg)
+		blocks := make([]*block.Block, 0, len(hashes))
+		for _, hash := range hashes {
+			b, err := h.bc.GetBlock(hash)
+			if err != nil {
+				break
+			}
+			blocks = append(blocks, b)
 		}
+		return newBlocksMessage(blocks)
 	}
+	return nil, fmt.Errorf("unexpected %s request", msg.Type)
 }
@@ -0,0 +1,149 @@
+package network
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// The identity key of the node is kept in IDENTITY_FILE_NAME in the data
+// directory, encoded as a libp2p private key, so that the peer ID survives a
+// restart.
+const (
+	IDENTITY_FILE_NAME = "identity.key"
+
+	KEY_TYPE_ED25519   = "ed25519"
+	KEY_TYPE_SECP256K1 = "secp256k1"
+	KEY_TYPE_RSA       = "rsa"
+	RSA_KEY_BITS       = 2048
+)
+
+func IdentityPath(dataDir string) string {
+	return filepath.Join(dataDir, IDENTITY_FILE_NAME)
+}
+
+func GenerateIdentity(keyType string) (crypto.PrivKey, error) {
+	var typ, bits int
+	switch strings.ToLower(keyType) {
+	case KEY_TYPE_ED25519:
+		typ = crypto.Ed25519
+	case KEY_TYPE_SECP256K1:
+		typ = crypto.Secp256k1
+	case KEY_TYPE_RSA:
+		typ, bits = crypto.RSA, RSA_KEY_BITS
+	default:
+		return nil, fmt.Errorf("unknown identity key type %q", keyType)
+	}
+	key, _, err := crypto.GenerateKeyPairWithReader(typ, bits, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate identity key: %w", err)
+	}
+	return key, nil
+}
+
+func LoadIdentity(path string) (crypto.PrivKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read identity: %w", err)
+	}
+	key, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode identity %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// SaveIdentity writes key to path through a temporary file, readable by the
+// owner only.
+func SaveIdentity(path string, key crypto.PrivKey) error {
+	data, err := crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("encode identity: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write identity: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write identity: %w", err)
+	}
+	return nil
+}
+
+// LoadOrCreateIdentity loads the identity at path, or generates one of the
+// given key type and saves it there if there is none yet.
+func LoadOrCreateIdentity(path, keyType string) (crypto.PrivKey, error) {
+	key, err := LoadIdentity(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+	key, err = GenerateIdentity(keyType)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveIdentity(path, key); err != nil {
+		return nil, err
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[NETWORK] Created %s identity %s in %s\n", keyType, id, path)
+	return key, nil
+}
+
+// RotateIdentity replaces the identity at path with a new key of the given
+// type. The previous key is kept next to it with an .old suffix.
+func RotateIdentity(path, keyType string) (crypto.PrivKey, error) {
+	key, err := GenerateIdentity(keyType)
+	if err != nil {
+		return nil, err
+	}
+	if err := backupIdentity(path); err != nil {
+		return nil, err
+	}
+	if err := SaveIdentity(path, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ImportIdentity replaces the identity at path with the key in file, which
+// must be encoded like an identity file. The previous key is kept next to it
+// with an .old suffix.
+func ImportIdentity(path, file string) (crypto.PrivKey, error) {
+	key, err := LoadIdentity(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := backupIdentity(path); err != nil {
+		return nil, err
+	}
+	if err := SaveIdentity(path, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func backupIdentity(path string) error {
+	err := os.Rename(path, path+".old")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("back up identity: %w", err)
+	}
+	return nil
+}
+
+// KeyTypeName returns the name of the type of an identity key.
+func KeyTypeName(key crypto.PrivKey) string {
+	return strings.ToLower(key.Type().String())
+}
@@ -1,6 +1,12 @@
 package network
 
 import (
+	"fmt"
+	"math/big"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/blockchain"
+	"github.com/fr13n8/go-blockchain/codec"
 	pb "github.com/fr13n8/go-blockchain/gen/peer"
 )
 
@@ -8,6 +14,38 @@ const (
 	messageAddTx    = "add_tx"
 	messageAddBlock = "add_block"
 	getPeers        = "get_peers"
+
+	messageGetStatus  = "get_status"
+	messageStatus     = "status"
+	messageGetHeaders = "get_headers"
+	messageHeaders    = "headers"
+	messageGetBlocks  = "get_blocks"
+	messageBlocks     = "blocks"
+)
+
+const USER_AGENT = "go-blockchain/0.0.1"
+
+// Features sent in the handshake.
+const (
+	FEATURE_HEADERS_SYNC = "headers-sync"
+	FEATURE_RELAY        = "relay"
+	// FEATURE_GOSSIPSUB is sent by nodes that propagate blocks and
+	// transactions over GossipSub rather than their sessions.
+	FEATURE_GOSSIPSUB = "gossipsub"
+)
+
+var FEATURES = []string{FEATURE_HEADERS_SYNC, FEATURE_RELAY}
+
+const (
+	// MAX_BLOCKS_PER_REQUEST is the most blocks asked for in one get_blocks
+	// message.
+	MAX_BLOCKS_PER_REQUEST = 64
+	// MAX_BLOCKS_MESSAGE_SIZE bounds the encoded blocks of a blocks message,
+	// which holds at least one block even if it is larger. It stays below the
+	// default gRPC message limit.
+	MAX_BLOCKS_MESSAGE_SIZE = 2 * blockchain.MAX_BLOCK_SIZE
+	// MAX_WORK_SIZE bounds the encoded cumulative work of a status message.
+	MAX_WORK_SIZE = 64
 )
 
 func NewAddTXMessage(txData []byte) *pb.MessageBody {
@@ -30,3 +68,195 @@ func NewGetPeersMessage(peersBytes []byte) *pb.MessageBody {
 		Data: peersBytes,
 	}
 }
+
+// Status describes the active chain of a node.
+type Status struct {
+	GenesisHash [32]byte
+	Height      uint64
+	BestHash    [32]byte
+	// Work is the cumulative proof of work of the chain, which decides
+	// which chain is followed.
+	Work *big.Int
+}
+
+func newGetStatusMessage() *pb.MessageBody {
+	return &pb.MessageBody{
+		Type: messageGetStatus,
+	}
+}
+
+func newStatusMessage(s *Status) *pb.MessageBody {
+	w := codec.NewWriter()
+	w.Version()
+	w.Fixed(s.GenesisHash[:])
+	w.Uint64(s.Height)
+	w.Fixed(s.BestHash[:])
+	w.VarBytes(s.Work.Bytes())
+	return &pb.MessageBody{
+		Type: messageStatus,
+		Data: w.Bytes(),
+	}
+}
+
+func decodeStatus(data []byte) (*Status, error) {
+	r := codec.NewReader(data)
+	r.Version()
+	s := &Status{}
+	copy(s.GenesisHash[:], r.Fixed(32))
+	s.Height = r.Uint64()
+	copy(s.BestHash[:], r.Fixed(32))
+	work := r.VarBytes()
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("decode status: %w", err)
+	}
+	if len(work) > MAX_WORK_SIZE {
+		return nil, fmt.Errorf("decode status: work of %d bytes exceeds %d", len(work), MAX_WORK_SIZE)
+	}
+	s.Work = new(big.Int).SetBytes(work)
+	return s, nil
+}
+
+func newGetHeadersMessage(locator [][32]byte, max uint32) *pb.MessageBody {
+	w := codec.NewWriter()
+	w.Version()
+	writeHashes(w, locator)
+	w.Uint32(max)
+	return &pb.MessageBody{
+		Type: messageGetHeaders,
+		Data: w.Bytes(),
+	}
+}
+
+func decodeGetHeaders(data []byte) ([][32]byte, uint32, error) {
+	r := codec.NewReader(data)
+	r.Version()
+	locator := readHashes(r)
+	max := r.Uint32()
+	if err := r.Finish(); err != nil {
+		return nil, 0, fmt.Errorf("decode get_headers: %w", err)
+	}
+	return locator, max, nil
+}
+
+func newHeadersMessage(headers []*block.Header) (*pb.MessageBody, error) {
+	w := codec.NewWriter()
+	w.Version()
+	w.Uvarint(uint64(len(headers)))
+	for _, h := range headers {
+		data, err := h.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		w.VarBytes(data)
+	}
+	return &pb.MessageBody{
+		Type: messageHeaders,
+		Data: w.Bytes(),
+	}, nil
+}
+
+func decodeHeaders(data []byte) ([]*block.Header, error) {
+	r := codec.NewReader(data)
+	r.Version()
+	headers := make([]*block.Header, r.Len(block.HEADER_SIZE))
+	for i := range headers {
+		h := &block.Header{}
+		headerData := r.VarBytes()
+		if r.Err() != nil {
+			break
+		}
+		if err := h.UnmarshalBinary(headerData); err != nil {
+			return nil, fmt.Errorf("decode headers: header %d: %w", i, err)
+		}
+		headers[i] = h
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("decode headers: %w", err)
+	}
+	return headers, nil
+}
+
+func newGetBlocksMessage(hashes [][32]byte) *pb.MessageBody {
+	w := codec.NewWriter()
+	w.Version()
+	writeHashes(w, hashes)
+	return &pb.MessageBody{
+		Type: messageGetBlocks,
+		Data: w.Bytes(),
+	}
+}
+
+func decodeGetBlocks(data []byte) ([][32]byte, error) {
+	r := codec.NewReader(data)
+	r.Version()
+	hashes := readHashes(r)
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("decode get_blocks: %w", err)
+	}
+	return hashes, nil
+}
+
+// newBlocksMessage encodes blocks until MAX_BLOCKS_MESSAGE_SIZE is reached.
+// The peer asks again for the blocks that did not fit.
+func newBlocksMessage(blocks []*block.Block) (*pb.MessageBody, error) {
+	var encoded [][]byte
+	size := 0
+	for _, b := range blocks {
+		data, err := b.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		if len(encoded) > 0 && size+len(data) > MAX_BLOCKS_MESSAGE_SIZE {
+			break
+		}
+		encoded = append(encoded, data)
+		size += len(data)
+	}
+
+	w := codec.NewWriter()
+	w.Version()
+	w.Uvarint(uint64(len(encoded)))
+	for _, data := range encoded {
+		w.VarBytes(data)
+	}
+	return &pb.MessageBody{
+		Type: messageBlocks,
+		Data: w.Bytes(),
+	}, nil
+}
+
+func decodeBlocks(data []byte) ([]*block.Block, error) {
+	r := codec.NewReader(data)
+	r.Version()
+	blocks := make([]*block.Block, r.Len(block.HEADER_SIZE))
+	for i := range blocks {
+		b := &block.Block{}
+		blockData := r.VarBytes()
+		if r.Err() != nil {
+			break
+		}
+		if err := b.UnmarshalBinary(blockData); err != nil {
+			return nil, fmt.Errorf("decode blocks: block %d: %w", i, err)
+		}
+		blocks[i] = b
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("decode blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+func writeHashes(w *codec.Writer, hashes [][32]byte) {
+	w.Uvarint(uint64(len(hashes)))
+	for _, hash := range hashes {
+		w.Fixed(hash[:])
+	}
+}
+
+func readHashes(r *codec.Reader) [][32]byte {
+	hashes := make([][32]byte, r.Len(32))
+	for i := range hashes {
+		copy(hashes[i][:], r.Fixed(32))
+	}
+	return hashes
+}
@@ -0,0 +1,33 @@
+package network
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/codec"
+)
+
+func TestStatusRoundTrip(t *testing.T) {
+	work, _ := new(big.Int).SetString("123456789abcdef0123456789abcdef", 16)
+	status := &Status{GenesisHash: [32]byte{1}, Height: 42, BestHash: [32]byte{2}, Work: work}
+	decoded, err := decodeStatus(newStatusMessage(status).Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.GenesisHash != status.GenesisHash || decoded.Height != status.Height ||
+		decoded.BestHash != status.BestHash || decoded.Work.Cmp(status.Work) != 0 {
+		t.Fatalf("decoded status %+v, want %+v", decoded, status)
+	}
+}
+
+func TestDecodeStatusRejectsLargeWork(t *testing.T) {
+	w := codec.NewWriter()
+	w.Version()
+	w.Fixed(make([]byte, 32))
+	w.Uint64(1)
+	w.Fixed(make([]byte, 32))
+	w.VarBytes(make([]byte, MAX_WORK_SIZE+1))
+	if _, err := decodeStatus(w.Bytes()); err == nil {
+		t.Fatal("status with oversized work was decoded")
+	}
+}
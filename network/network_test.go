@@ -0,0 +1,165 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/blockchain"
+	pb "github.com/fr13n8/go-blockchain/gen/peer"
+	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
+	"github.com/fr13n8/go-blockchain/storage"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/utils"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// trivial accepts every block, so tests do not have to search for nonces.
+type trivial struct{}
+
+func (trivial) Solve(*block.Block) bool { return true }
+func (trivial) Verify(block.Block) bool { return true }
+
+func testAddress(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return utils.AddressFromPublicKey(&key.PublicKey)
+}
+
+// testGenesis returns a genesis old enough for n blocks spaced by
+// TARGET_BLOCK_TIME.
+func testGenesis(n int) *blockchain.Genesis {
+	return &blockchain.Genesis{
+		ChainId:   "test",
+		Timestamp: time.Now().Add(-time.Duration(n+1) * blockchain.TARGET_BLOCK_TIME).Truncate(time.Second),
+		Target:    "1f00ffff",
+	}
+}
+
+func newTestChain(t *testing.T, genesis *blockchain.Genesis) *blockchain.BlockChain {
+	t.Helper()
+	store, err := storage.Open(&storage.Config{Backend: storage.BACKEND_MEMORY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := blockchain.NewConfig()
+	cfg.Genesis = genesis
+	bc, err := blockchain.NewBlockChain(cfg, store, trivial{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Close() })
+	return bc
+}
+
+// extend mines n blocks on top of the tip of bc, spaced by interval, and
+// returns the last one.
+func extend(t *testing.T, bc *blockchain.BlockChain, n int, interval time.Duration, miner string) *block.Block {
+	t.Helper()
+	var headers []*block.Header
+	for _, b := range bc.GetBlocks() {
+		headers = append(headers, &b.Header)
+	}
+	parent := bc.LastBlock()
+	for i := 0; i < n; i++ {
+		height := len(headers)
+		coinbase := blockchain.NewCoinbaseTransaction(miner, height, 0)
+		b := block.New(0, parent.Hash(), blockchain.RequiredHeaderTarget(headers), []*transaction.Transaction{coinbase})
+		b.Timestamp = parent.Timestamp + int64(interval)
+		if err := bc.CreateBlock(b); err != nil {
+			t.Fatalf("create block at height %d: %v", height, err)
+		}
+		headers = append(headers, &b.Header)
+		parent = b
+	}
+	return parent
+}
+
+// pipe is one end of an in-memory message stream.
+type pipe struct {
+	in   <-chan *pb.MessageBody
+	out  chan<- *pb.MessageBody
+	done <-chan struct{}
+}
+
+func (p *pipe) Send(msg *pb.MessageBody) error {
+	select {
+	case p.out <- msg:
+		return nil
+	case <-p.done:
+		return io.EOF
+	}
+}
+
+func (p *pipe) Recv() (*pb.MessageBody, error) {
+	select {
+	case msg := <-p.in:
+		return msg, nil
+	case <-p.done:
+		return nil, io.EOF
+	}
+}
+
+type testNode struct {
+	bc     *blockchain.BlockChain
+	host   host.Host
+	pm     *peer_manager.PeerManager
+	syncer *Syncer
+	relay  *Relay
+}
+
+// newTestNode wires a node around bc the way the server does, over a host
+// that does not listen.
+func newTestNode(t *testing.T, bc *blockchain.BlockChain) *testNode {
+	t.Helper()
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	bans, err := peer_manager.NewBanList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	pm := peer_manager.NewPeerManager(bans, peer_manager.MAX_PEERS)
+	syncer := NewSyncer(bc, pm)
+	relay := NewRelay(bc, pm, syncer)
+	handler := NewPeerHandler(bc, pm, relay)
+	pm.Start(ctx, h, "/go-blockchain/test", handler.Handshake, handler.Handle)
+	return &testNode{bc: bc, host: h, pm: pm, syncer: syncer, relay: relay}
+}
+
+// connect opens a session between a and b over an in-memory stream and waits
+// until both sides have it.
+func connect(t *testing.T, a, b *testNode) {
+	t.Helper()
+	ab, ba := make(chan *pb.MessageBody, 64), make(chan *pb.MessageBody, 64)
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		close(done)
+	})
+	go a.pm.Serve(ctx, b.host.ID(), &pipe{in: ba, out: ab, done: done}, true)
+	go b.pm.Serve(ctx, a.host.ID(), &pipe{in: ab, out: ba, done: done}, false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(a.pm.Sessions()) == 0 || len(b.pm.Sessions()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("session was not opened")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
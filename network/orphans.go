@@ -0,0 +1,106 @@
+package network
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/blockchain"
+	"github.com/fr13n8/go-blockchain/utils"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	MAX_ORPHANS   = 100
+	ORPHAN_EXPIRY = 20 * time.Minute
+)
+
+type orphan struct {
+	block *block.Block
+	// from is the peer that sent the block.
+	from    peer.ID
+	expires time.Time
+}
+
+// orphanPool keeps blocks whose parent is not known yet, so that they can be
+// connected once it arrives.
+type orphanPool struct {
+	orphans  map[[32]byte]*orphan
+	byParent map[[32]byte][][32]byte
+	mux      sync.Mutex
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		orphans:  make(map[[32]byte]*orphan),
+		byParent: make(map[[32]byte][][32]byte),
+	}
+}
+
+// add keeps b until its parent arrives or it expires. Since the parent is
+// needed for full validation, only the proof of work of the block is checked,
+// which makes filling the pool expensive. The oldest orphan is dropped when
+// the pool is full.
+func (p *orphanPool) add(b *block.Block, from peer.ID) error {
+	hash := b.Hash()
+	if b.Target > blockchain.POW_LIMIT {
+		return fmt.Errorf("target %08x is easier than the limit %08x", b.Target, blockchain.POW_LIMIT)
+	}
+	if utils.HashToBig(&hash).Cmp(block.CompactToBig(b.Target)) > 0 {
+		return fmt.Errorf("hash does not satisfy target %08x", b.Target)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	now := time.Now()
+	var oldest *orphan
+	for h, o := range p.orphans {
+		if now.After(o.expires) {
+			p.remove(h)
+		} else if oldest == nil || o.expires.Before(oldest.expires) {
+			oldest = o
+		}
+	}
+	if _, ok := p.orphans[hash]; ok {
+		return nil
+	}
+	if len(p.orphans) >= MAX_ORPHANS {
+		p.remove(oldest.block.Hash())
+	}
+	p.orphans[hash] = &orphan{block: b, from: from, expires: now.Add(ORPHAN_EXPIRY)}
+	p.byParent[b.PreviousHash] = append(p.byParent[b.PreviousHash], hash)
+	return nil
+}
+
+// take removes and returns the orphans whose parent is the given block.
+func (p *orphanPool) take(parent [32]byte) []*orphan {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	var children []*orphan
+	for _, hash := range append([][32]byte(nil), p.byParent[parent]...) {
+		children = append(children, p.orphans[hash])
+		p.remove(hash)
+	}
+	return children
+}
+
+func (p *orphanPool) remove(hash [32]byte) {
+	o, ok := p.orphans[hash]
+	if !ok {
+		return
+	}
+	delete(p.orphans, hash)
+	siblings := p.byParent[o.block.PreviousHash]
+	for i, h := range siblings {
+		if h == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, o.block.PreviousHash)
+	} else {
+		p.byParent[o.block.PreviousHash] = siblings
+	}
+}
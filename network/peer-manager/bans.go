@@ -0,0 +1,161 @@
+package peer_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const BAN_FILE_NAME = "bans.json"
+
+type Ban struct {
+	Peer   peer.ID   `json:"peer"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+}
+
+// BanList holds the peers that are not connected with until their ban
+// expires. It is saved to a file on every change, so that bans survive a
+// restart, and it is the connection gater of the host.
+type BanList struct {
+	path string
+	bans map[peer.ID]Ban
+	mux  sync.Mutex
+}
+
+var _ connmgr.ConnectionGater = (*BanList)(nil)
+
+// NewBanList loads the bans saved at path. An empty path keeps the bans in
+// memory only.
+func NewBanList(path string) (*BanList, error) {
+	bl := &BanList{
+		path: path,
+		bans: make(map[peer.ID]Ban),
+	}
+	if path == "" {
+		return bl, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return bl, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read ban list: %w", err)
+	}
+	var bans []Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, fmt.Errorf("decode ban list %s: %w", path, err)
+	}
+	now := time.Now()
+	for _, b := range bans {
+		if b.Until.After(now) {
+			bl.bans[b.Peer] = b
+		}
+	}
+	return bl, nil
+}
+
+// Ban bans a peer for d. A longer ban that is in place is kept.
+func (bl *BanList) Ban(id peer.ID, d time.Duration, reason string) error {
+	bl.mux.Lock()
+	defer bl.mux.Unlock()
+	until := time.Now().Add(d)
+	if b, ok := bl.bans[id]; ok && b.Until.After(until) {
+		return nil
+	}
+	bl.bans[id] = Ban{Peer: id, Until: until, Reason: reason}
+	return bl.save()
+}
+
+func (bl *BanList) Unban(id peer.ID) error {
+	bl.mux.Lock()
+	defer bl.mux.Unlock()
+	if _, ok := bl.bans[id]; !ok {
+		return nil
+	}
+	delete(bl.bans, id)
+	return bl.save()
+}
+
+func (bl *BanList) IsBanned(id peer.ID) bool {
+	bl.mux.Lock()
+	defer bl.mux.Unlock()
+	b, ok := bl.bans[id]
+	if ok && time.Now().After(b.Until) {
+		delete(bl.bans, id)
+		return false
+	}
+	return ok
+}
+
+// Bans returns the bans that have not expired.
+func (bl *BanList) Bans() []Ban {
+	bl.mux.Lock()
+	defer bl.mux.Unlock()
+	now := time.Now()
+	bans := make([]Ban, 0, len(bl.bans))
+	for _, b := range bl.bans {
+		if b.Until.After(now) {
+			bans = append(bans, b)
+		}
+	}
+	return bans
+}
+
+// save writes the bans to a temporary file that replaces the list, so that a
+// crash never leaves a partial list behind.
+func (bl *BanList) save() error {
+	if bl.path == "" {
+		return nil
+	}
+	now := time.Now()
+	bans := make([]Ban, 0, len(bl.bans))
+	for _, b := range bl.bans {
+		if b.Until.After(now) {
+			bans = append(bans, b)
+		}
+	}
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := bl.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write ban list: %w", err)
+	}
+	if err := os.Rename(tmp, bl.path); err != nil {
+		return fmt.Errorf("write ban list: %w", err)
+	}
+	return nil
+}
+
+func (bl *BanList) InterceptPeerDial(id peer.ID) bool {
+	return !bl.IsBanned(id)
+}
+
+func (bl *BanList) InterceptAddrDial(id peer.ID, _ multiaddr.Multiaddr) bool {
+	return !bl.IsBanned(id)
+}
+
+// InterceptAccept lets every connection through, since the peer is only known
+// once the connection is secured.
+func (bl *BanList) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (bl *BanList) InterceptSecured(_ network.Direction, id peer.ID, _ network.ConnMultiaddrs) bool {
+	return !bl.IsBanned(id)
+}
+
+func (bl *BanList) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,155 @@
+package peer_manager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newPeerID returns the id of a new key, which unlike a made-up id survives
+// the JSON encoding of the ban list.
+func newPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestBanList(t *testing.T) {
+	bl, err := NewBanList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, other := peer.ID("peer"), peer.ID("other")
+
+	if err := bl.Ban(id, time.Hour, "long"); err != nil {
+		t.Fatal(err)
+	}
+	if !bl.IsBanned(id) || bl.IsBanned(other) {
+		t.Fatal("IsBanned does not match the bans")
+	}
+	if bl.InterceptPeerDial(id) || bl.InterceptSecured(network.DirInbound, id, nil) {
+		t.Fatal("connection with a banned peer was allowed")
+	}
+	if !bl.InterceptPeerDial(other) || !bl.InterceptSecured(network.DirInbound, other, nil) {
+		t.Fatal("connection with a peer that is not banned was refused")
+	}
+
+	// a shorter ban does not cut a longer one short
+	if err := bl.Ban(id, time.Minute, "short"); err != nil {
+		t.Fatal(err)
+	}
+	if bans := bl.Bans(); len(bans) != 1 || bans[0].Reason != "long" {
+		t.Fatalf("Bans = %v, want the long ban", bans)
+	}
+
+	if err := bl.Ban(other, -time.Second, "expired"); err != nil {
+		t.Fatal(err)
+	}
+	if bl.IsBanned(other) {
+		t.Fatal("expired ban is in place")
+	}
+	if err := bl.Unban(id); err != nil {
+		t.Fatal(err)
+	}
+	if bl.IsBanned(id) || len(bl.Bans()) != 0 {
+		t.Fatal("ban is in place after Unban")
+	}
+}
+
+func TestBanListPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), BAN_FILE_NAME)
+	bl, err := NewBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	banned, unbanned := newPeerID(t), newPeerID(t)
+	for _, id := range []peer.ID{banned, unbanned} {
+		if err := bl.Ban(id, time.Hour, "misbehaved"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bl.Unban(unbanned); err != nil {
+		t.Fatal(err)
+	}
+
+	bl, err = NewBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bl.IsBanned(banned) || bl.IsBanned(unbanned) {
+		t.Fatal("reloaded bans do not match the saved ones")
+	}
+
+	// bans that expired while the node was down are dropped on load
+	data, err := json.Marshal([]Ban{{Peer: banned, Until: time.Now().Add(-time.Minute)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bl, err = NewBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bl.Bans()) != 0 {
+		t.Fatal("expired ban was loaded")
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBanList(path); err == nil {
+		t.Fatal("corrupt ban list was loaded")
+	}
+}
+
+func TestPenalize(t *testing.T) {
+	bans, err := NewBanList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm := NewPeerManager(bans, MAX_PEERS)
+	id := peer.ID("peer")
+
+	nm.Penalize(id, PENALTY_INVALID_MESSAGE, "invalid message")
+	if got := nm.Score(id); got != PENALTY_INVALID_MESSAGE {
+		t.Fatalf("Score = %d, want %d", got, PENALTY_INVALID_MESSAGE)
+	}
+	if bans.IsBanned(id) {
+		t.Fatal("peer was banned below the threshold")
+	}
+
+	// points decay over time
+	nm.scores[id].updated = nm.scores[id].updated.Add(-5 * SCORE_DECAY_INTERVAL)
+	if got, want := nm.Score(id), PENALTY_INVALID_MESSAGE-5; got != want {
+		t.Fatalf("Score after decay = %d, want %d", got, want)
+	}
+	nm.scores[id].updated = nm.scores[id].updated.Add(-BAN_THRESHOLD * SCORE_DECAY_INTERVAL)
+	nm.pruneScores()
+	if _, ok := nm.scores[id]; ok {
+		t.Fatal("decayed score was not pruned")
+	}
+
+	nm.Penalize(id, PENALTY_INVALID_MESSAGE, "invalid message")
+	nm.Penalize(id, PENALTY_INVALID_BLOCK, "invalid block")
+	if !bans.IsBanned(id) {
+		t.Fatal("peer was not banned at the threshold")
+	}
+	if got := nm.Score(id); got != 0 {
+		t.Fatalf("Score of a banned peer = %d, want 0", got)
+	}
+}
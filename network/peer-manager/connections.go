@@ -0,0 +1,137 @@
+package peer_manager
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// MIN_PEERS and MAX_PEERS are the default low and high watermarks of the
+	// number of peers. Discovery dials peers until there are MIN_PEERS, and
+	// no session is opened beyond MAX_PEERS.
+	MIN_PEERS = 8
+	MAX_PEERS = 32
+
+	// MAX_RECONNECT_DELAY caps the delay between failed dials of a peer,
+	// which doubles from RECONNECT_DELAY with every failure in a row.
+	MAX_RECONNECT_DELAY = time.Hour
+
+	// Peers with a session are tagged with SESSION_TAG_VALUE, so that the
+	// connection manager closes the other connections first.
+	SESSION_TAG       = "session"
+	SESSION_TAG_VALUE = 100
+	// Up to MAX_PROTECTED_PEERS peers that have had a session open for
+	// PROTECT_AFTER without misbehaving are never disconnected by the
+	// connection manager.
+	PROTECT_TAG         = "good-peer"
+	PROTECT_AFTER       = 30 * time.Minute
+	MAX_PROTECTED_PEERS = 4
+)
+
+var ErrTooManyPeers = errors.New("too many peers")
+
+type backoff struct {
+	failures int
+	until    time.Time
+}
+
+// failedDial records a failed dial of a peer and returns how long it is not
+// dialed again.
+func (nm *PeerManager) failedDial(id peer.ID) time.Duration {
+	nm.Lock()
+	defer nm.Unlock()
+	b, ok := nm.backoffs[id]
+	if !ok {
+		b = &backoff{}
+		nm.backoffs[id] = b
+	}
+	delay := min(RECONNECT_DELAY<<b.failures, MAX_RECONNECT_DELAY)
+	// stop doubling once the cap is reached, before the shift overflows
+	if delay < MAX_RECONNECT_DELAY {
+		b.failures++
+	}
+	b.until = time.Now().Add(delay)
+	return delay
+}
+
+func (nm *PeerManager) backingOff(id peer.ID) bool {
+	b, ok := nm.backoffs[id]
+	return ok && time.Now().Before(b.until)
+}
+
+// pruneBackoffs forgets the failed dials of the peers that have not been
+// dialed for MAX_RECONNECT_DELAY since their backoff expired.
+func (nm *PeerManager) pruneBackoffs() {
+	now := time.Now()
+	nm.Lock()
+	defer nm.Unlock()
+	for id, b := range nm.backoffs {
+		if now.Sub(b.until) > MAX_RECONNECT_DELAY {
+			delete(nm.backoffs, id)
+		}
+	}
+}
+
+// PeerCount returns the number of peers there is a session with or that are
+// being dialed.
+func (nm *PeerManager) PeerCount() int {
+	nm.Lock()
+	defer nm.Unlock()
+	return nm.peerCount()
+}
+
+func (nm *PeerManager) peerCount() int {
+	n := len(nm.sessions)
+	for id := range nm.dialing {
+		if _, ok := nm.sessions[id]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// protectPeers protects the oldest sessions with peers that have not
+// misbehaved from the connection manager, and stops protecting those that
+// have since.
+func (nm *PeerManager) protectPeers() {
+	sessions := nm.Sessions()
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return a.Opened.Compare(b.Opened)
+	})
+	now := time.Now()
+	for _, s := range sessions {
+		good := now.Sub(s.Opened) >= PROTECT_AFTER && nm.Score(s.ID) == 0
+		nm.Lock()
+		protected := nm.protected[s.ID]
+		full := len(nm.protected) >= MAX_PROTECTED_PEERS
+		nm.Unlock()
+		switch {
+		case good && !protected && !full:
+			nm.protect(s.ID)
+		case !good && protected:
+			nm.unprotect(s.ID)
+		}
+	}
+}
+
+func (nm *PeerManager) protect(id peer.ID) {
+	nm.Lock()
+	nm.protected[id] = true
+	h := nm.host
+	nm.Unlock()
+	h.ConnManager().Protect(id, PROTECT_TAG)
+}
+
+func (nm *PeerManager) unprotect(id peer.ID) {
+	nm.Lock()
+	protected := nm.protected[id]
+	delete(nm.protected, id)
+	h := nm.host
+	nm.Unlock()
+	if protected && h != nil {
+		h.ConnManager().Unprotect(id, PROTECT_TAG)
+	}
+}
@@ -0,0 +1,44 @@
+package peer_manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestFailedDialBackoff(t *testing.T) {
+	nm := NewPeerManager(nil, MAX_PEERS)
+	id := peer.ID("peer")
+
+	want := RECONNECT_DELAY
+	for i := 0; i < 100; i++ {
+		delay := nm.failedDial(id)
+		if delay != want {
+			t.Fatalf("delay after %d failures = %s, want %s", i+1, delay, want)
+		}
+		if !nm.backingOff(id) {
+			t.Fatalf("not backing off after %d failures", i+1)
+		}
+		want = min(2*want, MAX_RECONNECT_DELAY)
+	}
+}
+
+func TestPruneBackoffs(t *testing.T) {
+	nm := NewPeerManager(nil, MAX_PEERS)
+	recent, expired := peer.ID("recent"), peer.ID("expired")
+	nm.failedDial(recent)
+	nm.failedDial(expired)
+	nm.backoffs[expired].until = time.Now().Add(-MAX_RECONNECT_DELAY - time.Minute)
+
+	if nm.backingOff(expired) {
+		t.Fatal("backing off from a peer whose backoff expired")
+	}
+	nm.pruneBackoffs()
+	if _, ok := nm.backoffs[expired]; ok {
+		t.Fatal("expired backoff was not pruned")
+	}
+	if !nm.backingOff(recent) {
+		t.Fatal("recent backoff was pruned")
+	}
+}
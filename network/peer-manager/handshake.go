@@ -0,0 +1,115 @@
+package peer_manager
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/codec"
+	pb "github.com/fr13n8/go-blockchain/gen/peer"
+)
+
+const (
+	// PROTOCOL_VERSION is the version of the messages this node speaks. Peers
+	// older than MIN_PROTOCOL_VERSION are disconnected.
+	PROTOCOL_VERSION     = 2
+	MIN_PROTOCOL_VERSION = 2
+
+	// HANDSHAKE_TIMEOUT is how long a peer may take to send its handshake
+	// once a session is opened.
+	HANDSHAKE_TIMEOUT = 10 * time.Second
+	// INCOMPATIBLE_RETRY is how long a peer on another network is not dialed
+	// again.
+	INCOMPATIBLE_RETRY = time.Hour
+
+	MAX_USER_AGENT_LENGTH = 256
+	MAX_FEATURES          = 32
+
+	messageHandshake = "handshake"
+)
+
+// Handshake is the first message of every session, sent by both sides. It
+// tells which network a node is on and how far its chain is.
+type Handshake struct {
+	ProtocolVersion uint32
+	ChainId         string
+	GenesisHash     [32]byte
+	BestHeight      uint64
+	BestHash        [32]byte
+	UserAgent       string
+	// Features are the optional parts of the protocol the node supports.
+	Features []string
+}
+
+func (hs *Handshake) HasFeature(feature string) bool {
+	return slices.Contains(hs.Features, feature)
+}
+
+// compatible returns why a node that sent remote cannot be talked to by one
+// that sent hs, or nil if it can.
+func (hs *Handshake) compatible(remote *Handshake) error {
+	if remote.ProtocolVersion < MIN_PROTOCOL_VERSION {
+		return fmt.Errorf("protocol version %d is older than %d", remote.ProtocolVersion, MIN_PROTOCOL_VERSION)
+	}
+	if remote.ChainId != hs.ChainId {
+		return fmt.Errorf("chain id %q does not match %q", remote.ChainId, hs.ChainId)
+	}
+	if remote.GenesisHash != hs.GenesisHash {
+		return fmt.Errorf("genesis block %x does not match %x", remote.GenesisHash, hs.GenesisHash)
+	}
+	return nil
+}
+
+func newHandshakeMessage(hs *Handshake) *pb.MessageBody {
+	w := codec.NewWriter()
+	w.Version()
+	w.Uint32(hs.ProtocolVersion)
+	w.String(hs.ChainId)
+	w.Fixed(hs.GenesisHash[:])
+	w.Uint64(hs.BestHeight)
+	w.Fixed(hs.BestHash[:])
+	w.String(hs.UserAgent)
+	w.Uvarint(uint64(len(hs.Features)))
+	for _, f := range hs.Features {
+		w.String(f)
+	}
+	return &pb.MessageBody{
+		Type: messageHandshake,
+		Data: w.Bytes(),
+	}
+}
+
+func decodeHandshake(data []byte) (*Handshake, error) {
+	r := codec.NewReader(data)
+	r.Version()
+	hs := &Handshake{}
+	hs.ProtocolVersion = r.Uint32()
+	hs.ChainId = r.String()
+	copy(hs.GenesisHash[:], r.Fixed(32))
+	hs.BestHeight = r.Uint64()
+	copy(hs.BestHash[:], r.Fixed(32))
+	hs.UserAgent = r.String()
+	hs.Features = make([]string, r.Len(1))
+	for i := range hs.Features {
+		hs.Features[i] = r.String()
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("decode handshake: %w", err)
+	}
+	if len(hs.UserAgent) > MAX_USER_AGENT_LENGTH {
+		return nil, fmt.Errorf("decode handshake: user agent is longer than %d bytes", MAX_USER_AGENT_LENGTH)
+	}
+	if len(hs.Features) > MAX_FEATURES {
+		return nil, fmt.Errorf("decode handshake: more than %d features", MAX_FEATURES)
+	}
+	return hs, nil
+}
+
+// PeerInfo is what is known about a peer from its last handshake.
+type PeerInfo struct {
+	Handshake *Handshake
+	// Incompatible is why the peer was disconnected after the handshake, if
+	// it was.
+	Incompatible string
+	Updated      time.Time
+}
@@ -3,71 +3,492 @@ package peer_manager
 import (
 	"context"
 	"errors"
-	pb "github.com/fr13n8/go-blockchain/gen/peer"
-	"google.golang.org/grpc/peer"
+	"fmt"
+	"log"
+	"slices"
 	"sync"
+	"time"
+
+	pb "github.com/fr13n8/go-blockchain/gen/peer"
+	gr "github.com/fr13n8/go-blockchain/network/grpc"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
+const (
+	// KEEPALIVE_INTERVAL is how often every session is pinged.
+	KEEPALIVE_INTERVAL = 15 * time.Second
+	// KEEPALIVE_TIMEOUT is how long a session may stay silent before it is
+	// closed.
+	KEEPALIVE_TIMEOUT = 3 * KEEPALIVE_INTERVAL
+	// RECONNECT_DELAY is the time before a dropped outbound session is
+	// reopened, and the first delay after a failed dial. Dialing is given up
+	// after MAX_RECONNECTS failures in a row.
+	RECONNECT_DELAY = 10 * time.Second
+	MAX_RECONNECTS  = 5
+
+	messagePing = "ping"
+	messagePong = "pong"
+)
+
+// Handler processes a message received in a session. An error is counted
+// against the peer as an invalid message.
+type Handler func(s *Session, msg *pb.MessageBody) error
+
+// PeerManager owns the sessions with the peers, one per peer ID whichever side
+// opened it. It dials the peers it is asked to connect to, keeps the sessions
+// alive and reopens outbound ones that drop, backing off from peers that
+// cannot be dialed. Peers that misbehave are scored and banned.
 type PeerManager struct {
-	peers map[string]pb.PeerService_MessageServer
+	host       host.Host
+	protocolID protocol.ID
+	local      func() *Handshake
+	handler    Handler
+	ctx        context.Context
+	bans       *BanList
+	maxPeers   int
+
+	sessions map[peer.ID]*Session
+	scores   map[peer.ID]*score
+	peers    map[peer.ID]*PeerInfo
+	// dialing holds the cancel functions of the outbound sessions that are
+	// kept open.
+	dialing     map[peer.ID]context.CancelFunc
+	backoffs    map[peer.ID]*backoff
+	protected   map[peer.ID]bool
+	subscribers []func(*Session)
 	sync.Mutex
 }
 
-func NewPeerManager() *PeerManager {
+// NewPeerManager returns a manager that keeps sessions with up to maxPeers
+// peers.
+func NewPeerManager(bans *BanList, maxPeers int) *PeerManager {
 	return &PeerManager{
-		peers: make(map[string]pb.PeerService_MessageServer),
+		bans:      bans,
+		maxPeers:  maxPeers,
+		sessions:  make(map[peer.ID]*Session),
+		scores:    make(map[peer.ID]*score),
+		peers:     make(map[peer.ID]*PeerInfo),
+		dialing:   make(map[peer.ID]context.CancelFunc),
+		backoffs:  make(map[peer.ID]*backoff),
+		protected: make(map[peer.ID]bool),
 	}
 }
 
-//func (nm *PeerManager) GetClientFromPeerId(peerID peer.ID) (pb.PeerService_MessageClient, error) {
-//	stream, err := nm.mainServer.Host.NewStream(context.Background(), peerID, protocol.ID(nm.mainServer.Config.ProtocolID))
-//	if err != nil {
-//		return nil, err
-//	}
-//	client := nm.mainServer.GrpcStream.Client(stream)
-//	cn := pb.PeerService_MessageClient(client)
-//	return cn, nil
-//}
+// Start makes the manager dial over h with the given protocol, open every
+// session with the handshake returned by local and pass the messages that
+// follow to handler. It must be called before sessions are served; they are
+// closed when ctx is done.
+func (nm *PeerManager) Start(ctx context.Context, h host.Host, protocolID string, local func() *Handshake, handler Handler) {
+	nm.Lock()
+	nm.host = h
+	nm.protocolID = protocol.ID(protocolID)
+	nm.local = local
+	nm.handler = handler
+	nm.ctx = ctx
+	nm.Unlock()
+	go nm.keepalive(ctx)
+}
 
-func (nm *PeerManager) AddPeer(s pb.PeerService_MessageServer) error {
+// Subscribe registers fn to be called with every new session.
+func (nm *PeerManager) Subscribe(fn func(*Session)) {
 	nm.Lock()
 	defer nm.Unlock()
-	p, ok := peer.FromContext(s.Context())
-	if !ok {
-		return errors.New("failed to get peer from context")
+	nm.subscribers = append(nm.subscribers, fn)
+}
+
+// Serve runs a session over stream until it fails, the session is closed or
+// ctx is done. The session starts once both peers have sent a compatible
+// handshake. When both peers open a session at the same time, both keep the
+// one opened by the peer with the lower ID. Otherwise a new session replaces
+// the earlier one. Sessions opened by peers are refused once there are
+// sessions with as many peers as allowed.
+func (nm *PeerManager) Serve(ctx context.Context, id peer.ID, stream Stream, outbound bool) error {
+	if !outbound && nm.full(id) {
+		return fmt.Errorf("refusing session with peer %s: %w", id, ErrTooManyPeers)
 	}
-	nm.peers[p.Addr.String()] = s
-	return nil
+	remote, err := nm.handshake(ctx, id, stream)
+	if err != nil {
+		return err
+	}
+	return nm.serve(ctx, id, stream, outbound, remote)
 }
 
-func (nm *PeerManager) RemovePeer(address string) {
+func (nm *PeerManager) serve(ctx context.Context, id peer.ID, stream Stream, outbound bool, remote *Handshake) error {
+	s := newSession(id, stream, outbound)
+	s.Handshake = remote
 	nm.Lock()
-	defer nm.Unlock()
-	delete(nm.peers, address)
+	if old, ok := nm.sessions[id]; ok {
+		if old.Outbound != outbound && outbound != (nm.host.ID() < id) {
+			nm.Unlock()
+			return fmt.Errorf("there is a session with peer %s already", id)
+		}
+		old.Close()
+	}
+	nm.sessions[id] = s
+	nm.host.ConnManager().TagPeer(id, SESSION_TAG, SESSION_TAG_VALUE)
+	handler := nm.handler
+	subscribers := append(([]func(*Session))(nil), nm.subscribers...)
+	nm.Unlock()
+	defer nm.remove(s)
+	defer s.Close()
+
+	direction := "inbound"
+	if outbound {
+		direction = "outbound"
+	}
+	log.Printf("[NETWORK] Opened %s session with peer %s (%s) at height %d\n", direction, id, remote.UserAgent, remote.BestHeight)
+	defer log.Printf("[NETWORK] Closed %s session with peer %s\n", direction, id)
+
+	go s.writeLoop()
+	messages := make(chan *pb.MessageBody)
+	errs := make(chan error, 1)
+	go s.readLoop(messages, errs)
+	for _, fn := range subscribers {
+		fn(s)
+	}
+
+	var window time.Time
+	received := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case msg := <-messages:
+			// replies to the requests and pings of this node do not count
+			// against the peer
+			if msg.Type == messagePong || s.deliver(msg) {
+				continue
+			}
+			if now := time.Now(); now.Sub(window) >= time.Second {
+				window, received = now, 0
+			}
+			received++
+			if received > MAX_MESSAGES_PER_SECOND {
+				if received == MAX_MESSAGES_PER_SECOND+1 {
+					nm.Penalize(id, PENALTY_SPAM, "too many messages")
+				}
+				continue
+			}
+			if msg.Type == messagePing {
+				s.Send(&pb.MessageBody{Type: messagePong})
+				continue
+			}
+			err := handler(s, msg)
+			if errors.Is(err, ErrSessionClosed) || errors.Is(err, ErrSendQueueFull) {
+				return err
+			}
+			if err != nil {
+				nm.Penalize(id, PENALTY_INVALID_MESSAGE, err.Error())
+			}
+		}
+	}
+}
+
+// handshake exchanges handshakes over a new stream and records the one of the
+// peer. A peer on another network is disconnected and not dialed again for
+// INCOMPATIBLE_RETRY.
+func (nm *PeerManager) handshake(ctx context.Context, id peer.ID, stream Stream) (*Handshake, error) {
+	if nm.bans.IsBanned(id) {
+		return nil, fmt.Errorf("peer %s is banned", id)
+	}
+	nm.Lock()
+	localFn := nm.local
+	nm.Unlock()
+	local := localFn()
+	if err := stream.Send(newHandshakeMessage(local)); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		msg *pb.MessageBody
+		err error
+	}
+	received := make(chan result, 1)
+	go func() {
+		msg, err := stream.Recv()
+		received <- result{msg, err}
+	}()
+	var r result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(HANDSHAKE_TIMEOUT):
+		return nil, fmt.Errorf("peer %s did not send a handshake", id)
+	case r = <-received:
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.msg.Type != messageHandshake {
+		err := fmt.Errorf("expected a handshake, got %s", r.msg.Type)
+		nm.Penalize(id, PENALTY_INVALID_MESSAGE, err.Error())
+		return nil, err
+	}
+	remote, err := decodeHandshake(r.msg.Data)
+	if err != nil {
+		nm.Penalize(id, PENALTY_INVALID_MESSAGE, err.Error())
+		return nil, err
+	}
+
+	info := &PeerInfo{Handshake: remote, Updated: time.Now()}
+	err = local.compatible(remote)
+	if err != nil {
+		info.Incompatible = err.Error()
+	}
+	nm.Lock()
+	nm.peers[id] = info
+	nm.Unlock()
+	if err != nil {
+		log.Printf("[NETWORK] Disconnecting incompatible peer %s: %v\n", id, err)
+		nm.Disconnect(id)
+		return nil, err
+	}
+	return remote, nil
 }
 
-func (nm *PeerManager) GetPeers() map[string]pb.PeerService_MessageServer {
+func (nm *PeerManager) remove(s *Session) {
+	nm.Lock()
+	current := nm.sessions[s.ID] == s
+	if current {
+		delete(nm.sessions, s.ID)
+		delete(nm.peers, s.ID)
+		nm.host.ConnManager().UntagPeer(s.ID, SESSION_TAG)
+	}
+	nm.Unlock()
+	if current {
+		nm.unprotect(s.ID)
+	}
+}
+
+// full reports whether a session with a peer would be one too many.
+func (nm *PeerManager) full(id peer.ID) bool {
 	nm.Lock()
 	defer nm.Unlock()
-	return nm.peers
+	_, ok := nm.sessions[id]
+	return !ok && len(nm.sessions) >= nm.maxPeers
 }
 
-func (nm *PeerManager) GetAllPeersAddresses() []string {
+// Connect opens an outbound session with a peer unless there is a session
+// with it already, there are as many peers as allowed or dialing it failed
+// recently. The session is reopened when it drops. It reports whether the
+// peer is dialed.
+func (nm *PeerManager) Connect(info peer.AddrInfo) bool {
 	nm.Lock()
 	defer nm.Unlock()
-	var addresses []string
-	for address := range nm.peers {
-		addresses = append(addresses, address)
+	if nm.host == nil || info.ID == nm.host.ID() || nm.bans.IsBanned(info.ID) {
+		return false
+	}
+	if _, ok := nm.sessions[info.ID]; ok {
+		return false
 	}
-	return addresses
+	if _, ok := nm.dialing[info.ID]; ok {
+		return false
+	}
+	if nm.backingOff(info.ID) || nm.peerCount() >= nm.maxPeers {
+		return false
+	}
+	if p, ok := nm.peers[info.ID]; ok && p.Incompatible != "" && time.Since(p.Updated) < INCOMPATIBLE_RETRY {
+		return false
+	}
+	ctx, cancel := context.WithCancel(nm.ctx)
+	nm.dialing[info.ID] = cancel
+	nm.host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.TempAddrTTL)
+	go nm.dial(ctx, info.ID)
+	return true
+}
+
+// dial keeps an outbound session with the peer open until it fails to
+// reconnect MAX_RECONNECTS times in a row, the peer opens a session itself,
+// there are sessions with as many peers as allowed or ctx is done. The delay
+// between failed dials doubles up to MAX_RECONNECT_DELAY.
+func (nm *PeerManager) dial(ctx context.Context, id peer.ID) {
+	defer func() {
+		nm.Lock()
+		nm.dialing[id]()
+		delete(nm.dialing, id)
+		nm.Unlock()
+	}()
+
+	failures := 0
+	for {
+		opened, err := nm.openSession(ctx, id)
+		if ctx.Err() != nil {
+			return
+		}
+		delay := RECONNECT_DELAY
+		if opened {
+			failures = 0
+			nm.Lock()
+			delete(nm.backoffs, id)
+			nm.Unlock()
+		} else {
+			failures++
+			delay = nm.failedDial(id)
+			log.Printf("[NETWORK] Connecting to peer %s failed, retrying in %s: %v\n", id, delay, err)
+		}
+		if failures >= MAX_RECONNECTS {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		nm.Lock()
+		_, ok := nm.sessions[id]
+		nm.Unlock()
+		if ok || nm.full(id) {
+			return
+		}
+	}
+}
+
+// openSession opens a stream to the peer and serves it. It reports whether
+// the session was established, which takes a compatible handshake.
+func (nm *PeerManager) openSession(ctx context.Context, id peer.ID) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := nm.host.NewStream(ctx, id, nm.protocolID)
+	if err != nil {
+		return false, err
+	}
+	conn := gr.WrapClient(stream)
+	defer conn.Close()
+	client, err := pb.NewPeerServiceClient(conn).Message(ctx)
+	if err != nil {
+		return false, err
+	}
+	remote, err := nm.handshake(ctx, id, client)
+	if err != nil {
+		return false, err
+	}
+	return true, nm.serve(ctx, id, client, true, remote)
 }
 
-func (nm *PeerManager) BroadcastMessage(ctx context.Context, msg *pb.MessageBody) {
-	for addr, s := range nm.GetPeers() {
-		go func(server pb.PeerService_MessageServer, addr string) {
-			if err := server.Send(msg); err != nil {
-				nm.RemovePeer(addr)
+func (nm *PeerManager) keepalive(ctx context.Context) {
+	ticker := time.NewTicker(KEEPALIVE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		nm.pruneScores()
+		nm.pruneBackoffs()
+		nm.prunePeers()
+		nm.protectPeers()
+		for _, s := range nm.Sessions() {
+			if s.idle() > KEEPALIVE_TIMEOUT {
+				log.Printf("[NETWORK] Peer %s timed out\n", s.ID)
+				s.Close()
+				continue
 			}
-		}(s, addr)
+			s.Send(&pb.MessageBody{Type: messagePing})
+		}
+	}
+}
+
+// Disconnect closes the session and the connections with a peer and stops
+// reconnecting to it.
+func (nm *PeerManager) Disconnect(id peer.ID) {
+	nm.Lock()
+	s, ok := nm.sessions[id]
+	if cancel, dialing := nm.dialing[id]; dialing {
+		cancel()
+	}
+	h := nm.host
+	nm.Unlock()
+	if ok {
+		s.Close()
+	}
+	if h != nil {
+		if err := h.Network().ClosePeer(id); err != nil {
+			log.Printf("[NETWORK] Error while disconnecting peer %s: %v\n", id, err)
+		}
+	}
+}
+
+// Session returns the session with a peer.
+func (nm *PeerManager) Session(id peer.ID) (*Session, bool) {
+	nm.Lock()
+	defer nm.Unlock()
+	s, ok := nm.sessions[id]
+	return s, ok
+}
+
+func (nm *PeerManager) Sessions() []*Session {
+	nm.Lock()
+	defer nm.Unlock()
+	sessions := make([]*Session, 0, len(nm.sessions))
+	for _, s := range nm.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// prunePeers forgets the handshakes of the peers there is no session with,
+// but those of incompatible peers until they may be dialed again. A
+// handshake is kept for HANDSHAKE_TIMEOUT while its session is opened.
+func (nm *PeerManager) prunePeers() {
+	nm.Lock()
+	defer nm.Unlock()
+	for id, info := range nm.peers {
+		if _, ok := nm.sessions[id]; ok {
+			continue
+		}
+		retry := HANDSHAKE_TIMEOUT
+		if info.Incompatible != "" {
+			retry = INCOMPATIBLE_RETRY
+		}
+		if time.Since(info.Updated) >= retry {
+			delete(nm.peers, id)
+		}
+	}
+}
+
+// Peer returns what is known about a peer from its last handshake. Only the
+// peers there is a session with and the incompatible peers that are not
+// dialed again yet are known.
+func (nm *PeerManager) Peer(id peer.ID) (PeerInfo, bool) {
+	nm.Lock()
+	defer nm.Unlock()
+	info, ok := nm.peers[id]
+	if !ok {
+		return PeerInfo{}, false
+	}
+	return *info, true
+}
+
+// GetPeers returns the IDs of the peers there is a session with.
+func (nm *PeerManager) GetPeers() []peer.ID {
+	nm.Lock()
+	defer nm.Unlock()
+	peers := make([]peer.ID, 0, len(nm.sessions))
+	for id := range nm.sessions {
+		peers = append(peers, id)
+	}
+	return peers
+}
+
+// BroadcastMessage sends msg to every peer except the given ones, which is
+// where the message came from when it is relayed.
+func (nm *PeerManager) BroadcastMessage(ctx context.Context, msg *pb.MessageBody, except ...peer.ID) {
+	for _, s := range nm.Sessions() {
+		if slices.Contains(except, s.ID) {
+			continue
+		}
+		if err := s.Send(msg); err != nil {
+			log.Printf("[NETWORK] Error while sending %s to peer %s: %v\n", msg.Type, s.ID, err)
+		}
 	}
 }
@@ -0,0 +1,106 @@
+package peer_manager
+
+import (
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// A peer is banned for BAN_DURATION once its misbehavior score reaches
+// BAN_THRESHOLD. Scores fall by one point every SCORE_DECAY_INTERVAL, so that
+// occasional mistakes of an honest peer are forgotten.
+const (
+	BAN_THRESHOLD        = 100
+	BAN_DURATION         = 24 * time.Hour
+	SCORE_DECAY_INTERVAL = time.Minute
+
+	// PENALTY_INVALID_BLOCK is given for blocks and headers that break the
+	// consensus rules. Their proof of work is checked first, so they are
+	// expensive to make up and never sent by an honest peer.
+	PENALTY_INVALID_BLOCK = BAN_THRESHOLD
+	// PENALTY_INVALID_TRANSACTION is given for transactions that are invalid
+	// whatever the state of the ledger, such as those with a bad signature.
+	PENALTY_INVALID_TRANSACTION = 20
+	// PENALTY_INVALID_MESSAGE is given for messages that cannot be decoded or
+	// that break the limits of the protocol.
+	PENALTY_INVALID_MESSAGE = 20
+	// PENALTY_SPAM is given once for every second in which a peer sends more
+	// than MAX_MESSAGES_PER_SECOND messages. The messages beyond are dropped.
+	PENALTY_SPAM            = 5
+	MAX_MESSAGES_PER_SECOND = 200
+)
+
+type score struct {
+	points  int
+	updated time.Time
+}
+
+func (sc *score) decay(now time.Time) {
+	n := int(now.Sub(sc.updated) / SCORE_DECAY_INTERVAL)
+	if n == 0 {
+		return
+	}
+	sc.points = max(sc.points-n, 0)
+	sc.updated = sc.updated.Add(time.Duration(n) * SCORE_DECAY_INTERVAL)
+}
+
+// Penalize adds points to the misbehavior score of a peer, which is no longer
+// protected from the connection manager, and bans it if the score reaches
+// BAN_THRESHOLD.
+func (nm *PeerManager) Penalize(id peer.ID, points int, reason string) {
+	now := time.Now()
+	nm.Lock()
+	sc, ok := nm.scores[id]
+	if !ok {
+		sc = &score{updated: now}
+		nm.scores[id] = sc
+	}
+	sc.decay(now)
+	sc.points += points
+	total := sc.points
+	nm.Unlock()
+	nm.unprotect(id)
+
+	log.Printf("[NETWORK] Peer %s misbehaved, score %d: %s\n", id, total, reason)
+	if total >= BAN_THRESHOLD {
+		nm.Ban(id, BAN_DURATION, reason)
+	}
+}
+
+// Score returns the misbehavior score of a peer.
+func (nm *PeerManager) Score(id peer.ID) int {
+	nm.Lock()
+	defer nm.Unlock()
+	sc, ok := nm.scores[id]
+	if !ok {
+		return 0
+	}
+	sc.decay(time.Now())
+	return sc.points
+}
+
+// Ban disconnects a peer and refuses connections with it for d.
+func (nm *PeerManager) Ban(id peer.ID, d time.Duration, reason string) {
+	log.Printf("[NETWORK] Banning peer %s for %s: %s\n", id, d, reason)
+	if err := nm.bans.Ban(id, d, reason); err != nil {
+		log.Printf("[NETWORK] Error while saving ban of peer %s: %v\n", id, err)
+	}
+	nm.Lock()
+	delete(nm.scores, id)
+	nm.Unlock()
+	nm.Disconnect(id)
+}
+
+// pruneScores forgets the peers whose score has decayed to zero.
+func (nm *PeerManager) pruneScores() {
+	now := time.Now()
+	nm.Lock()
+	defer nm.Unlock()
+	for id, sc := range nm.scores {
+		sc.decay(now)
+		if sc.points == 0 {
+			delete(nm.scores, id)
+		}
+	}
+}
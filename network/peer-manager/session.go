@@ -0,0 +1,175 @@
+package peer_manager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/fr13n8/go-blockchain/gen/peer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SEND_QUEUE_SIZE is the number of messages that may wait to be written to a
+// peer. A peer that does not keep up is disconnected.
+const SEND_QUEUE_SIZE = 256
+
+var (
+	ErrSessionClosed = errors.New("session closed")
+	ErrSendQueueFull = errors.New("send queue full")
+)
+
+// Stream is a message stream with a peer, the server side of a stream the
+// peer opened or the client side of one opened to it.
+type Stream interface {
+	Send(*pb.MessageBody) error
+	Recv() (*pb.MessageBody, error)
+}
+
+// Session is the message stream with a peer. Messages are written in the
+// order they are sent by a single writer.
+type Session struct {
+	ID       peer.ID
+	Outbound bool
+	// Handshake is the handshake the peer opened the session with.
+	Handshake *Handshake
+	Opened    time.Time
+
+	stream   Stream
+	queue    chan *pb.MessageBody
+	lastRecv atomic.Int64
+	closed   chan struct{}
+	close    sync.Once
+
+	// requestMux allows a single request at a time, whose reply is delivered
+	// to replies instead of the handler.
+	requestMux sync.Mutex
+	waitingMux sync.Mutex
+	waiting    string
+	replies    chan *pb.MessageBody
+}
+
+func newSession(id peer.ID, stream Stream, outbound bool) *Session {
+	s := &Session{
+		ID:       id,
+		Outbound: outbound,
+		Opened:   time.Now(),
+		stream:   stream,
+		queue:    make(chan *pb.MessageBody, SEND_QUEUE_SIZE),
+		closed:   make(chan struct{}),
+		replies:  make(chan *pb.MessageBody, 1),
+	}
+	s.lastRecv.Store(time.Now().UnixNano())
+	return s
+}
+
+// Send queues msg to be written to the peer. The session is closed if the
+// queue is full.
+func (s *Session) Send(msg *pb.MessageBody) error {
+	select {
+	case <-s.closed:
+		return ErrSessionClosed
+	default:
+	}
+	select {
+	case s.queue <- msg:
+		return nil
+	default:
+		s.Close()
+		return ErrSendQueueFull
+	}
+}
+
+// Request sends msg and waits for the next message of type reply from the
+// peer until ctx is done.
+func (s *Session) Request(ctx context.Context, msg *pb.MessageBody, reply string) (*pb.MessageBody, error) {
+	s.requestMux.Lock()
+	defer s.requestMux.Unlock()
+
+	s.waitingMux.Lock()
+	// drop a reply that came after an earlier request gave up
+	select {
+	case <-s.replies:
+	default:
+	}
+	s.waiting = reply
+	s.waitingMux.Unlock()
+	defer func() {
+		s.waitingMux.Lock()
+		s.waiting = ""
+		s.waitingMux.Unlock()
+	}()
+
+	if err := s.Send(msg); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-s.replies:
+		return resp, nil
+	case <-s.closed:
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// deliver hands msg to a waiting request and reports whether there was one.
+func (s *Session) deliver(msg *pb.MessageBody) bool {
+	s.waitingMux.Lock()
+	defer s.waitingMux.Unlock()
+	if s.waiting == "" || msg.Type != s.waiting {
+		return false
+	}
+	s.waiting = ""
+	s.replies <- msg
+	return true
+}
+
+// Close ends the session. It is safe to call more than once.
+func (s *Session) Close() {
+	s.close.Do(func() {
+		close(s.closed)
+	})
+}
+
+// Done is closed when the session ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *Session) idle() time.Duration {
+	return time.Since(time.Unix(0, s.lastRecv.Load()))
+}
+
+func (s *Session) writeLoop() {
+	for {
+		select {
+		case <-s.closed:
+			return
+		case msg := <-s.queue:
+			if err := s.stream.Send(msg); err != nil {
+				s.Close()
+				return
+			}
+		}
+	}
+}
+
+// readLoop feeds the messages of the peer to messages until the stream fails
+// or the session is closed.
+func (s *Session) readLoop(messages chan<- *pb.MessageBody, errs chan<- error) {
+	for {
+		msg, err := s.stream.Recv()
+		if err != nil {
+			errs <- err
+			return
+		}
+		s.lastRecv.Store(time.Now().UnixNano())
+		select {
+		case messages <- msg:
+		case <-s.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package network
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/blockchain"
+	pb "github.com/fr13n8/go-blockchain/gen/peer"
+	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
+	"github.com/fr13n8/go-blockchain/transaction"
+	lru "github.com/hashicorp/golang-lru"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SEEN_BLOCKS and SEEN_TRANSACTIONS are the number of recent messages
+// remembered, so that a block or transaction is processed and relayed only
+// once. They are remembered by the hash of the whole encoding rather than by
+// id, since neither a block hash nor a transaction id covers everything that
+// is sent: a copy with a broken body or witness must not hide the real one.
+// Only messages that were accepted or are invalid for good are remembered;
+// the ones rejected for the current state of the chain are processed again
+// when they are received again.
+const (
+	SEEN_BLOCKS       = 1024
+	SEEN_TRANSACTIONS = 16384
+)
+
+// Relay announces new blocks and transactions to the peers and processes the
+// ones they announce. They are propagated over GossipSub once StartGossip is
+// called, and sent over the sessions of the peers that do not support it.
+type Relay struct {
+	bc         *blockchain.BlockChain
+	pm         *peer_manager.PeerManager
+	syncer     *Syncer
+	seenBlocks *lru.Cache
+	seenTxs    *lru.Cache
+	orphans    *orphanPool
+	gossip     *gossip
+	mux        sync.Mutex
+}
+
+func NewRelay(bc *blockchain.BlockChain, pm *peer_manager.PeerManager, syncer *Syncer) *Relay {
+	seenBlocks, err := lru.New(SEEN_BLOCKS)
+	if err != nil {
+		panic(err)
+	}
+	seenTxs, err := lru.New(SEEN_TRANSACTIONS)
+	if err != nil {
+		panic(err)
+	}
+	return &Relay{
+		bc:         bc,
+		pm:         pm,
+		syncer:     syncer,
+		seenBlocks: seenBlocks,
+		seenTxs:    seenTxs,
+		orphans:    newOrphanPool(),
+	}
+}
+
+// AnnounceBlock sends a block created by this node to every peer.
+func (r *Relay) AnnounceBlock(b *block.Block) {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		log.Printf("[NETWORK] Error while encoding block %s: %v\n", b.HexHash(), err)
+		return
+	}
+	r.seenBlocks.Add(sha256.Sum256(data), struct{}{})
+	r.relay(TOPIC_BLOCKS, NewAddBlockMessage(data), "", true)
+}
+
+// AnnounceTransaction sends a transaction this node has pooled to every peer.
+func (r *Relay) AnnounceTransaction(t *transaction.Transaction) error {
+	data, err := t.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encode transaction %s: %w", t.HexHash(), err)
+	}
+	r.seenTxs.Add(sha256.Sum256(data), struct{}{})
+	r.relay(TOPIC_TRANSACTIONS, NewAddTXMessage(data), "", true)
+	return nil
+}
+
+// relay sends msg to every peer but the one it came from: it is published to
+// topic if publish is set, and sent over the sessions of the peers that do
+// not take part in GossipSub.
+func (r *Relay) relay(topic string, msg *pb.MessageBody, from peer.ID, publish bool) {
+	except := []peer.ID{from}
+	if g := r.getGossip(); g != nil {
+		if publish {
+			g.publish(topic, msg.Data)
+		}
+		for _, s := range r.pm.Sessions() {
+			if s.Handshake.HasFeature(FEATURE_GOSSIPSUB) {
+				except = append(except, s.ID)
+			}
+		}
+	}
+	r.pm.BroadcastMessage(context.Background(), msg, except...)
+}
+
+// handleTransaction processes a transaction sent by peer from over its
+// session. It fails only if the data is not a transaction.
+func (r *Relay) handleTransaction(data []byte, from peer.ID) error {
+	_, err := r.receiveTransaction(data, from, true)
+	return err
+}
+
+// receiveTransaction verifies a transaction from peer from and pools it. A
+// transaction that is accepted is relayed to every peer but the one it came
+// from, and published unless it arrived over GossipSub, which forwards it
+// itself. The peer is penalized for a transaction that is invalid whatever
+// the state of the ledger. Transactions that were seen before are ignored.
+func (r *Relay) receiveTransaction(data []byte, from peer.ID, publish bool) (pubsub.ValidationResult, error) {
+	key := sha256.Sum256(data)
+	if r.seenTxs.Contains(key) {
+		return pubsub.ValidationIgnore, nil
+	}
+	t := &transaction.Transaction{}
+	if err := t.UnmarshalBinary(data); err != nil {
+		r.seenTxs.Add(key, struct{}{})
+		return pubsub.ValidationReject, err
+	}
+	if err := r.bc.CheckTransaction(t); err != nil {
+		r.seenTxs.Add(key, struct{}{})
+		r.pm.Penalize(from, peer_manager.PENALTY_INVALID_TRANSACTION, fmt.Sprintf("invalid transaction %s: %s", t.HexHash(), err))
+		return pubsub.ValidationReject, nil
+	}
+	// a transaction the ledger rejects, such as one with a nonce gap or from
+	// a sender that is not funded yet, may be accepted later
+	if !r.bc.CreateTransaction(t) {
+		log.Printf("[NETWORK] Rejected transaction %s from peer %s\n", t.HexHash(), from)
+		return pubsub.ValidationIgnore, nil
+	}
+	r.seenTxs.Add(key, struct{}{})
+	log.Printf("[NETWORK] Accepted transaction %s from peer %s\n", t.HexHash(), from)
+	r.relay(TOPIC_TRANSACTIONS, NewAddTXMessage(data), from, publish)
+	return pubsub.ValidationAccept, nil
+}
+
+// handleBlock processes a block sent by peer from over its session. It fails
+// only if the data is not a block.
+func (r *Relay) handleBlock(data []byte, from peer.ID) error {
+	_, err := r.receiveBlock(data, from, true)
+	return err
+}
+
+// receiveBlock processes a block from peer from. Blocks that were seen before
+// are ignored.
+func (r *Relay) receiveBlock(data []byte, from peer.ID, publish bool) (pubsub.ValidationResult, error) {
+	key := sha256.Sum256(data)
+	if r.seenBlocks.Contains(key) {
+		return pubsub.ValidationIgnore, nil
+	}
+	b := &block.Block{}
+	if err := b.UnmarshalBinary(data); err != nil {
+		r.seenBlocks.Add(key, struct{}{})
+		return pubsub.ValidationReject, err
+	}
+	result, final := r.processBlock(b, from, publish)
+	if final {
+		r.seenBlocks.Add(key, struct{}{})
+	}
+	return result, nil
+}
+
+// processBlock validates b and connects it to the chain. A block that is
+// accepted is relayed like a transaction, and the orphans waiting for it are
+// processed next. A block with an unknown parent is kept as an orphan, but
+// not forwarded, and a sync is started to fetch the missing blocks. The peer
+// is penalized for a block that breaks the consensus rules, but not for one
+// that is only ahead of the local clock. processBlock also reports whether
+// the outcome is final, which it is not for a block that may be accepted
+// when it is received again.
+func (r *Relay) processBlock(b *block.Block, from peer.ID, publish bool) (pubsub.ValidationResult, bool) {
+	err := r.bc.CreateBlock(b)
+	var blockErr *blockchain.BlockError
+	switch {
+	case err == nil:
+		log.Printf("[NETWORK] Accepted block %s from peer %s\n", b.HexHash(), from)
+		data, err := b.MarshalBinary()
+		if err != nil {
+			log.Printf("[NETWORK] Error while encoding block %s: %v\n", b.HexHash(), err)
+		} else {
+			r.relay(TOPIC_BLOCKS, NewAddBlockMessage(data), from, publish)
+		}
+		for _, o := range r.orphans.take(b.Hash()) {
+			r.processBlock(o.block, o.from, true)
+		}
+		return pubsub.ValidationAccept, true
+	case errors.As(err, &blockErr) && blockErr.Code == blockchain.REJECT_DUPLICATE:
+		return pubsub.ValidationIgnore, true
+	case errors.As(err, &blockErr) && blockErr.Code == blockchain.REJECT_ORPHAN:
+		if err := r.orphans.add(b, from); err != nil {
+			log.Printf("[NETWORK] Rejected orphan block %s from peer %s: %v\n", b.HexHash(), from, err)
+			r.pm.Penalize(from, peer_manager.PENALTY_INVALID_BLOCK, fmt.Sprintf("invalid orphan block %s: %s", b.HexHash(), err))
+			return pubsub.ValidationReject, true
+		}
+		log.Printf("[NETWORK] Keeping orphan block %s from peer %s\n", b.HexHash(), from)
+		r.syncer.Trigger()
+		return pubsub.ValidationIgnore, true
+	case isTimeTooNew(err):
+		log.Printf("[NETWORK] Ignoring block %s from peer %s: %v\n", b.HexHash(), from, err)
+		return pubsub.ValidationIgnore, false
+	case errors.As(err, &blockErr):
+		log.Printf("[NETWORK] Rejected block %s from peer %s: %v\n", b.HexHash(), from, err)
+		r.pm.Penalize(from, peer_manager.PENALTY_INVALID_BLOCK, err.Error())
+		return pubsub.ValidationReject, true
+	default:
+		log.Printf("[NETWORK] Error while adding block %s from peer %s: %v\n", b.HexHash(), from, err)
+		return pubsub.ValidationIgnore, false
+	}
+}
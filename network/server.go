@@ -2,7 +2,6 @@ package network
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
 	"github.com/fr13n8/go-blockchain/blockchain"
 	pb "github.com/fr13n8/go-blockchain/gen/peer"
@@ -13,22 +12,48 @@ import (
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
 	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	"log"
 	"net"
+	"time"
 )
 
+// CONN_GRACE_PERIOD is how long a new connection is kept by the connection
+// manager whatever the number of peers.
+const CONN_GRACE_PERIOD = time.Minute
+
 type Config struct {
 	ServerName string
 	DNS        multiaddr.Multiaddr
 	Addr       *net.TCPAddr
 	ProtocolID string
 	Rendezvous string
+	// GossipSub propagates blocks and transactions over GossipSub. Otherwise,
+	// and to peers that do not support it, they are sent over the sessions.
+	GossipSub bool
+	// DHT finds peers with a Kademlia DHT rendezvous, which needs a boot
+	// node, and MDNS finds them on the local network.
+	DHT  bool
+	MDNS bool
+	// MinPeers and MaxPeers are the low and high watermarks of the connection
+	// manager. Discovery dials peers until there are MinPeers, and once there
+	// are more than MaxPeers connections the least useful are closed.
+	MinPeers int
+	MaxPeers int
+	// Identity is the key the peer ID is derived from. A new Ed25519 key is
+	// generated on every start if it is nil.
+	Identity crypto.PrivKey
 
 	Bc          *blockchain.BlockChain
 	Miner       *miner.Miner
 	PeerManager *peer_manager.PeerManager
+	BanList     *peer_manager.BanList
+	Syncer      *Syncer
+	Relay       *Relay
 }
 
 type Server struct {
@@ -36,6 +61,7 @@ type Server struct {
 	Host       host.Host
 	Config     *Config
 	CancelFunc context.CancelFunc
+	Discovery  *discovery.Service
 }
 
 func NewConfig() *Config {
@@ -47,6 +73,11 @@ func NewConfig() *Config {
 		},
 		ProtocolID: "/go-blockchain/0.0.1",
 		Rendezvous: "go-blockchain",
+		GossipSub:  true,
+		DHT:        true,
+		MDNS:       true,
+		MinPeers:   peer_manager.MIN_PEERS,
+		MaxPeers:   peer_manager.MAX_PEERS,
 	}
 }
 
@@ -69,14 +100,27 @@ func NewServer(cfg *Config) *Server {
 }
 
 func (s *Server) Run(bootstrapPeers []multiaddr.Multiaddr, peerAddress chan<- []string) string {
-	r := rand.Reader
-	prvKey, _, err := crypto.GenerateKeyPairWithReader(crypto.RSA, 2048, r)
+	prvKey := s.Config.Identity
+	if prvKey == nil {
+		key, err := GenerateIdentity(KEY_TYPE_ED25519)
+		if err != nil {
+			log.Println("[NETWORK] Error while generating key pair: ", err)
+			return ""
+		}
+		prvKey = key
+	}
+
+	cm, err := connmgr.NewConnManager(s.Config.MinPeers, s.Config.MaxPeers, connmgr.WithGracePeriod(CONN_GRACE_PERIOD))
 	if err != nil {
-		log.Println("[NETWORK] Error while generating key pair: ", err)
+		log.Println("[NETWORK] Error while creating connection manager: ", err)
 		return ""
 	}
-
-	h, err := libp2p.New(libp2p.ListenAddrs(s.Config.DNS), libp2p.Identity(prvKey))
+	h, err := libp2p.New(
+		libp2p.ListenAddrs(s.Config.DNS),
+		libp2p.Identity(prvKey),
+		libp2p.ConnectionGater(s.Config.BanList),
+		libp2p.ConnectionManager(cm),
+	)
 	if err != nil {
 		log.Println("[NETWORK] Error while creating host: ", err)
 		return ""
@@ -85,8 +129,15 @@ func (s *Server) Run(bootstrapPeers []multiaddr.Multiaddr, peerAddress chan<- []
 	s.GrpcStream = gr.NewStream()
 	ctx, cancel := context.WithCancel(context.Background())
 	s.CancelFunc = cancel
-	handlers := NewPeerHandler(s.Config.PeerManager)
+	if s.Config.GossipSub {
+		if err := s.Config.Relay.StartGossip(ctx, s.Host); err != nil {
+			log.Println("[NETWORK] Error while starting gossipsub: ", err)
+			return ""
+		}
+	}
+	handlers := NewPeerHandler(s.Config.Bc, s.Config.PeerManager, s.Config.Relay)
 	pb.RegisterPeerServiceServer(s.GrpcStream, handlers)
+	s.Config.PeerManager.Start(ctx, s.Host, s.Config.ProtocolID, handlers.Handshake, handlers.Handle)
 
 	s.Host.SetStreamHandler(protocol.ID(s.Config.ProtocolID), s.GrpcStream.Handler())
 
@@ -98,23 +149,67 @@ func (s *Server) Run(bootstrapPeers []multiaddr.Multiaddr, peerAddress chan<- []
 		log.Printf("[NETWORK] %s/p2p/%s\n", addr, s.Host.ID().String())
 	}
 
-	discoveryService := discovery.NewDiscoveryService(s.Config.PeerManager)
-	kademliaDHT, err := discoveryService.NewDHT(ctx, s.Host, bootstrapPeers)
-	if err != nil {
-		log.Println("[NETWORK] Error while creating DHT: ", err)
-		return ""
+	s.Discovery = discovery.NewDiscoveryService(s.Config.PeerManager, s.Config.MinPeers)
+	if s.Config.DHT {
+		kademliaDHT, err := s.Discovery.NewDHT(ctx, s.Host, bootstrapPeers)
+		if err != nil {
+			log.Println("[NETWORK] Error while creating DHT: ", err)
+			return ""
+		}
+		if err = kademliaDHT.Bootstrap(ctx); err != nil {
+			log.Println("[NETWORK] Error while bootstrapping DHT: ", err)
+			return ""
+		}
+		go s.Discovery.Discover(ctx, s.Host, kademliaDHT, s.Config.Rendezvous)
+	} else {
+		for _, addr := range bootstrapPeers {
+			info, err := peer.AddrInfoFromP2pAddr(addr)
+			if err != nil {
+				log.Println("[NETWORK] Error while parsing boot node address: ", err)
+				return ""
+			}
+			s.Config.PeerManager.Connect(*info)
+		}
 	}
-	if err = kademliaDHT.Bootstrap(ctx); err != nil {
-		log.Println("[NETWORK] Error while bootstrapping DHT: ", err)
-		return ""
+	if s.Config.MDNS {
+		if err := s.Discovery.StartMDNS(s.Host, s.Config.Rendezvous); err != nil {
+			log.Println("[NETWORK] Error while starting mDNS discovery: ", err)
+			return ""
+		}
+	}
+	if !s.Config.DHT && !s.Config.MDNS {
+		log.Println("[NETWORK] Peer discovery is disabled, only boot nodes are connected to")
 	}
 
-	go discoveryService.Discover(ctx, s.Host, kademliaDHT, s.Config.Rendezvous, s.GrpcStream, s.Config.ProtocolID, peerAddress)
+	go s.Config.Syncer.Run(ctx)
+	go s.Discovery.ReportPeers(ctx, s.Host, peerAddress)
 
-	return fmt.Sprintf("%s/p2p/%s", s.Host.Addrs()[1], s.Host.ID().String())
+	return s.address()
+}
+
+// address returns the address other nodes connect to this one on, preferring
+// one that is not a loopback address.
+func (s *Server) address() string {
+	addrs := s.Host.Addrs()
+	if len(addrs) == 0 {
+		return ""
+	}
+	addr := addrs[0]
+	for _, a := range addrs {
+		if !manet.IsIPLoopback(a) {
+			addr = a
+			break
+		}
+	}
+	return fmt.Sprintf("%s/p2p/%s", addr, s.Host.ID().String())
 }
 
 func (s *Server) ShutdownGracefully() {
+	if s.Discovery != nil {
+		if err := s.Discovery.Close(); err != nil {
+			log.Println("[NETWORK] Error while stopping mDNS discovery: ", err)
+		}
+	}
 	err := s.Host.Close()
 	if err != nil {
 		log.Println("[NETWORK] Error while closing host: ", err)
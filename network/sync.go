@@ -0,0 +1,364 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/blockchain"
+	pb "github.com/fr13n8/go-blockchain/gen/peer"
+	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	SYNC_INTERVAL = 10 * time.Second
+	// SYNC_TIMEOUT is how long a peer may take to answer a sync request
+	// before it is considered stalled.
+	SYNC_TIMEOUT = 20 * time.Second
+	// SYNC_STALL_BACKOFF is how long a peer that stalled or could not be
+	// reached is not synced from.
+	SYNC_STALL_BACKOFF = time.Minute
+	// SYNC_BAN_TIME is how long a peer that sent invalid data is not synced
+	// from.
+	SYNC_BAN_TIME = 30 * time.Minute
+)
+
+type SyncState string
+
+const (
+	SYNC_IDLE    SyncState = "idle"
+	SYNC_HEADERS SyncState = "headers"
+	SYNC_BLOCKS  SyncState = "blocks"
+)
+
+// SyncStatus reports the progress of the chain download.
+type SyncStatus struct {
+	State SyncState
+	// Peer is the peer blocks are downloaded from.
+	Peer string
+	// StartHeight is the height of the chain when the download started.
+	StartHeight int
+	Height      int
+	// HeaderHeight is the height of the last validated header.
+	HeaderHeight int
+	// TargetHeight is the height the peer reported.
+	TargetHeight int
+	LastError    string
+}
+
+var errStalled = errors.New("peer stalled")
+
+// misbehaviorError is returned for data that breaks the protocol or the
+// consensus rules, as opposed to a peer that is just slow or gone.
+type misbehaviorError struct {
+	err error
+}
+
+func (e *misbehaviorError) Error() string {
+	return e.err.Error()
+}
+
+func misbehavior(format string, args ...interface{}) error {
+	return &misbehaviorError{err: fmt.Errorf(format, args...)}
+}
+
+// Syncer downloads the chain from the peer whose chain has the most work,
+// headers first. A batch of headers is validated before the bodies of its blocks are
+// requested, and every block is validated as it is connected.
+type Syncer struct {
+	bc      *blockchain.BlockChain
+	pm      *peer_manager.PeerManager
+	trigger chan struct{}
+	// skip holds peers that are not synced from until the given time.
+	skip   map[peer.ID]time.Time
+	status SyncStatus
+	mux    sync.Mutex
+}
+
+func NewSyncer(bc *blockchain.BlockChain, pm *peer_manager.PeerManager) *Syncer {
+	return &Syncer{
+		bc:      bc,
+		pm:      pm,
+		trigger: make(chan struct{}, 1),
+		skip:    make(map[peer.ID]time.Time),
+		status:  SyncStatus{State: SYNC_IDLE},
+	}
+}
+
+// Status returns the current progress of the sync.
+func (s *Syncer) Status() SyncStatus {
+	s.mux.Lock()
+	status := s.status
+	s.mux.Unlock()
+	status.Height = s.bc.Height()
+	return status
+}
+
+// Run syncs with the peers every SYNC_INTERVAL and whenever a session with a
+// new peer is opened, until ctx is done.
+func (s *Syncer) Run(ctx context.Context) {
+	s.pm.Subscribe(func(*peer_manager.Session) {
+		s.Trigger()
+	})
+
+	ticker := time.NewTicker(SYNC_INTERVAL)
+	defer ticker.Stop()
+	for {
+		s.sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+	}
+}
+
+// Trigger makes Run sync without waiting for the next interval.
+func (s *Syncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Syncer) sync(ctx context.Context) {
+	sess, status := s.bestPeer(ctx)
+	if sess == nil {
+		return
+	}
+
+	err := s.download(ctx, sess, status)
+	// a peer that reported more work than it delivered is not picked again
+	// until the stall backoff ends, so it cannot keep others from being
+	// synced from
+	if _, _, work := s.bc.Tip(); err == nil && status.Work.Cmp(work) > 0 {
+		err = fmt.Errorf("peer reported more work than its chain has")
+	}
+	s.updateStatus(func(st *SyncStatus) {
+		st.State = SYNC_IDLE
+		st.Peer = ""
+		st.LastError = ""
+		if err != nil {
+			st.LastError = fmt.Sprintf("peer %s: %s", sess.ID, err)
+		}
+	})
+	if err != nil {
+		s.fail(sess.ID, err)
+		return
+	}
+	log.Printf("[NETWORK] Synced with peer %s at height %d\n", sess.ID, s.bc.Height())
+}
+
+// bestPeer asks every peer for its status and returns the session with the
+// one whose chain has the most work, if it has more than the active chain.
+// The height does not matter, a shorter chain can have more work.
+func (s *Syncer) bestPeer(ctx context.Context) (*peer_manager.Session, *Status) {
+	var best *peer_manager.Session
+	var bestStatus *Status
+	_, _, work := s.bc.Tip()
+	for _, sess := range s.pm.Sessions() {
+		if s.skipped(sess.ID) {
+			continue
+		}
+		status, err := s.peerStatus(ctx, sess)
+		if err == nil && status.GenesisHash != s.bc.GenesisHash() {
+			err = misbehavior("peer is on a chain with genesis block %x", status.GenesisHash)
+		}
+		if err != nil {
+			s.fail(sess.ID, err)
+			continue
+		}
+		if status.Work.Cmp(work) > 0 && (bestStatus == nil || status.Work.Cmp(bestStatus.Work) > 0) {
+			best, bestStatus = sess, status
+		}
+	}
+	return best, bestStatus
+}
+
+// download fetches headers after the active chain from the session peer and
+// then the blocks they belong to, batch by batch, until the peer has no more.
+func (s *Syncer) download(ctx context.Context, sess *peer_manager.Session, status *Status) error {
+	startHeight := s.bc.Height()
+	log.Printf("[NETWORK] Syncing from peer %s at height %d, local height %d\n", sess.ID, status.Height, startHeight)
+	s.updateStatus(func(st *SyncStatus) {
+		st.Peer = sess.ID.String()
+		st.StartHeight = startHeight
+		st.HeaderHeight = startHeight
+		st.TargetHeight = int(status.Height)
+	})
+
+	var last [32]byte
+	for {
+		s.updateStatus(func(st *SyncStatus) { st.State = SYNC_HEADERS })
+		// after the first batch the peer continues where its last batch
+		// ended, even if the active chain has not moved there yet
+		locator := s.bc.BlockLocator()
+		if last != [32]byte{} {
+			locator = append([][32]byte{last}, locator...)
+		}
+		reply, err := s.request(ctx, sess, newGetHeadersMessage(locator, blockchain.MAX_HEADERS), messageHeaders)
+		if err != nil {
+			return err
+		}
+		headers, err := decodeHeaders(reply.Data)
+		if err != nil {
+			return misbehavior("%s", err)
+		}
+		if len(headers) == 0 {
+			return nil
+		}
+		if len(headers) > blockchain.MAX_HEADERS {
+			return misbehavior("peer sent %d headers, at most %d are allowed", len(headers), blockchain.MAX_HEADERS)
+		}
+		height, moreWork, err := s.bc.CheckHeaders(headers)
+		if isTimeTooNew(err) {
+			return err
+		}
+		if err != nil {
+			return misbehavior("invalid headers: %s", err)
+		}
+		final := len(headers) < blockchain.MAX_HEADERS
+		// a branch that needs several batches may only overtake the active
+		// chain with a later one
+		if final && !moreWork {
+			return nil
+		}
+		last = headers[len(headers)-1].Hash
+
+		var missing [][32]byte
+		for _, h := range headers {
+			if !s.bc.HasBlock(h.Hash) {
+				missing = append(missing, h.Hash)
+			}
+		}
+		s.updateStatus(func(st *SyncStatus) {
+			st.State = SYNC_BLOCKS
+			st.HeaderHeight = height
+		})
+		if err := s.downloadBlocks(ctx, sess, missing); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// downloadBlocks fetches the blocks with the given hashes in order and adds
+// them to the chain.
+func (s *Syncer) downloadBlocks(ctx context.Context, sess *peer_manager.Session, hashes [][32]byte) error {
+	for len(hashes) > 0 {
+		batch := hashes
+		if len(batch) > MAX_BLOCKS_PER_REQUEST {
+			batch = batch[:MAX_BLOCKS_PER_REQUEST]
+		}
+		reply, err := s.request(ctx, sess, newGetBlocksMessage(batch), messageBlocks)
+		if err != nil {
+			return err
+		}
+		blocks, err := decodeBlocks(reply.Data)
+		if err != nil {
+			return misbehavior("%s", err)
+		}
+		if len(blocks) == 0 || len(blocks) > len(batch) {
+			return misbehavior("peer sent %d blocks for a request of %d", len(blocks), len(batch))
+		}
+		for i, b := range blocks {
+			if hash := b.Hash(); hash != batch[i] {
+				return misbehavior("peer sent block %x instead of %x", hash, batch[i])
+			}
+			if err := s.bc.CreateBlock(b); err != nil {
+				// only a block the consensus rules reject is the fault of
+				// the peer, a failure to store it is not
+				var blockErr *blockchain.BlockError
+				if !errors.As(err, &blockErr) {
+					return fmt.Errorf("add block %x: %w", batch[i], err)
+				}
+				if blockErr.Code == blockchain.REJECT_DUPLICATE {
+					continue
+				}
+				if blockErr.Code == blockchain.REJECT_TIME_TOO_NEW {
+					return err
+				}
+				return misbehavior("%s", err)
+			}
+		}
+		hashes = hashes[len(blocks):]
+	}
+	return nil
+}
+
+// isTimeTooNew reports whether err rejects a block only for being ahead of
+// the local clock, which is not the fault of the peer that sent it.
+func isTimeTooNew(err error) bool {
+	var blockErr *blockchain.BlockError
+	return errors.As(err, &blockErr) && blockErr.Code == blockchain.REJECT_TIME_TOO_NEW
+}
+
+// fail keeps a peer that stalled or misbehaved from being synced from for a
+// while. A misbehaving peer is also penalized.
+func (s *Syncer) fail(p peer.ID, err error) {
+	// a session that was replaced, as when both peers dial each other, is
+	// synced from again once the new one is opened
+	if errors.Is(err, peer_manager.ErrSessionClosed) {
+		return
+	}
+	backoff := SYNC_STALL_BACKOFF
+	var mErr *misbehaviorError
+	if errors.As(err, &mErr) {
+		backoff = SYNC_BAN_TIME
+		s.pm.Penalize(p, peer_manager.PENALTY_INVALID_BLOCK, fmt.Sprintf("invalid sync data: %s", err))
+	} else {
+		log.Printf("[NETWORK] Sync with peer %s failed: %v\n", p, err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.skip[p] = time.Now().Add(backoff)
+}
+
+func (s *Syncer) skipped(p peer.ID) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	until, ok := s.skip[p]
+	if ok && time.Now().After(until) {
+		delete(s.skip, p)
+		return false
+	}
+	return ok
+}
+
+func (s *Syncer) updateStatus(fn func(*SyncStatus)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	fn(&s.status)
+}
+
+// request sends msg to the peer of a session and waits for a reply of the
+// given type. A peer that does not answer within SYNC_TIMEOUT is stalled.
+func (s *Syncer) request(ctx context.Context, sess *peer_manager.Session, msg *pb.MessageBody, reply string) (*pb.MessageBody, error) {
+	ctx, cancel := context.WithTimeout(ctx, SYNC_TIMEOUT)
+	defer cancel()
+	resp, err := sess.Request(ctx, msg, reply)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, errStalled
+	}
+	return resp, err
+}
+
+func (s *Syncer) peerStatus(ctx context.Context, sess *peer_manager.Session) (*Status, error) {
+	reply, err := s.request(ctx, sess, newGetStatusMessage(), messageStatus)
+	if err != nil {
+		return nil, err
+	}
+	status, err := decodeStatus(reply.Data)
+	if err != nil {
+		return nil, misbehavior("%s", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,69 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/blockchain"
+)
+
+func TestSyncAcrossHeaderBatches(t *testing.T) {
+	const n = 2*blockchain.MAX_HEADERS + 5
+	genesis := testGenesis(n)
+	remote := newTestNode(t, newTestChain(t, genesis))
+	tip := extend(t, remote.bc, n, blockchain.TARGET_BLOCK_TIME, testAddress(t))
+	local := newTestNode(t, newTestChain(t, genesis))
+	connect(t, local, remote)
+
+	local.syncer.sync(context.Background())
+	if local.bc.LastBlock().Hash() != tip.Hash() || local.bc.Height() != n {
+		t.Fatalf("synced to %s at height %d, want %s at height %d", local.bc.LastBlock().HexHash(), local.bc.Height(), tip.HexHash(), n)
+	}
+	if status := local.syncer.Status(); status.State != SYNC_IDLE || status.LastError != "" {
+		t.Fatalf("sync ended in state %s with error %q", status.State, status.LastError)
+	}
+}
+
+func TestSyncFollowsMostWork(t *testing.T) {
+	genesis := testGenesis(40)
+	// blocks four times faster than the target time raise the difficulty, so
+	// the shorter remote chain has more work
+	remote := newTestNode(t, newTestChain(t, genesis))
+	tip := extend(t, remote.bc, 22, blockchain.TARGET_BLOCK_TIME/4, testAddress(t))
+	local := newTestNode(t, newTestChain(t, genesis))
+	extend(t, local.bc, 25, blockchain.TARGET_BLOCK_TIME, testAddress(t))
+	connect(t, local, remote)
+
+	local.syncer.sync(context.Background())
+	if local.bc.LastBlock().Hash() != tip.Hash() {
+		t.Fatalf("local tip %s at height %d, want the remote tip %s at height 22", local.bc.LastBlock().HexHash(), local.bc.Height(), tip.HexHash())
+	}
+
+	// the remote node has nothing to sync from the local one now
+	remote.syncer.sync(context.Background())
+	if remote.bc.LastBlock().Hash() != tip.Hash() {
+		t.Fatalf("remote tip moved to %s", remote.bc.LastBlock().HexHash())
+	}
+	if remote.syncer.skipped(local.host.ID()) {
+		t.Fatal("peer without more work was skipped")
+	}
+}
+
+func TestSyncSkipsPeerWithoutMoreWork(t *testing.T) {
+	genesis := testGenesis(10)
+	remote := newTestNode(t, newTestChain(t, genesis))
+	extend(t, remote.bc, 5, blockchain.TARGET_BLOCK_TIME, testAddress(t))
+	local := newTestNode(t, newTestChain(t, genesis))
+	extend(t, local.bc, 5, blockchain.TARGET_BLOCK_TIME, testAddress(t))
+	tip := local.bc.LastBlock()
+	connect(t, local, remote)
+
+	// a chain of equal work is not switched to
+	local.syncer.sync(context.Background())
+	if local.bc.LastBlock().Hash() != tip.Hash() {
+		t.Fatalf("local tip moved to %s", local.bc.LastBlock().HexHash())
+	}
+	if status := local.syncer.Status(); status.State != SYNC_IDLE {
+		t.Fatalf("sync ended in state %s", status.State)
+	}
+}
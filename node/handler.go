@@ -2,7 +2,7 @@ package node
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/hex"
 	"fmt"
 	pb "github.com/fr13n8/go-blockchain/gen/node"
 	"github.com/fr13n8/go-blockchain/network"
@@ -25,14 +25,17 @@ func NewNodeHandler(service *Server) *NodeHandler {
 func (h *NodeHandler) Ping(ctx context.Context, req *pb.PingRequest) (*pb.PingResponse, error) {
 	resp := &pb.PingResponse{
 		Message: "pong",
+		Ledger:  h.ns.config.Bc.LedgerModel(),
+		ChainId: h.ns.config.Bc.ChainId(),
 	}
 	return resp, nil
 }
 
 func (h *NodeHandler) GetBlocks(ctx context.Context, req *pb.GetBlocksRequest) (*pb.GetBlocksResponse, error) {
-	blocks := make([]string, 0, len(h.ns.config.Bc.GetBlocks()))
-	for _, b := range h.ns.config.Bc.GetBlocks() {
-		blocks = append(blocks, b.HexHash())
+	hashes := h.ns.config.Bc.GetBlockHashes()
+	blocks := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		blocks = append(blocks, fmt.Sprintf("%x", hash))
 	}
 
 	return &pb.GetBlocksResponse{
@@ -53,7 +56,12 @@ func (h *NodeHandler) GetBlock(ctx context.Context, req *pb.GetBlockRequest) (*p
 			Id:               tx.HexHash(),
 			SenderAddress:    tx.SenderAddress,
 			RecipientAddress: tx.RecipientAddress,
-			Amount:           tx.Amount,
+			Amount:           uint64(tx.Amount),
+			Inputs:           inputsToPb(tx.Inputs),
+			Outputs:          outputsToPb(tx.Outputs),
+			Nonce:            tx.Nonce,
+			ChainId:          tx.ChainId,
+			Fee:              uint64(tx.Fee),
 		})
 	}
 
@@ -64,7 +72,7 @@ func (h *NodeHandler) GetBlock(ctx context.Context, req *pb.GetBlockRequest) (*p
 			Hash:           b.HexHash(),
 			PreviousHash:   fmt.Sprintf("%x", b.PreviousHash),
 			Nonce:          b.Nonce,
-			Target:         fmt.Sprintf("%x", b.Header.Target),
+			Target:         fmt.Sprintf("%08x", b.Header.Target),
 		},
 		Transactions: transactions,
 	}, nil
@@ -82,36 +90,40 @@ func (h *NodeHandler) GetTransactions(ctx context.Context, req *pb.GetTransactio
 }
 
 func (h *NodeHandler) CreateTransaction(ctx context.Context, req *pb.CreateTransactionRequest) (*pb.CreateTransactionResponse, error) {
+	inputs, err := inputsFromPb(req.GetInputs())
+	if err != nil {
+		return nil, err
+	}
 	tx := transaction.Request{
+		ChainId:          req.GetChainId(),
 		SenderAddress:    req.GetSenderAddress(),
 		RecipientAddress: req.GetRecipientAddress(),
-		Amount:           req.GetAmount(),
+		Amount:           transaction.Amount(req.GetAmount()),
+		Fee:              transaction.Amount(req.GetFee()),
+		Nonce:            req.GetNonce(),
 		SenderPublicKey:  req.GetSenderPublicKey(),
 		Signature:        req.GetSignature(),
+		Inputs:           inputs,
+		Outputs:          outputsFromPb(req.GetOutputs()),
 	}
 
 	if !tx.Validate() {
 		return nil, fmt.Errorf("invalid transaction")
 	}
 
-	publicKey := utils.PublicKeyFromString(tx.SenderPublicKey)
-	signature := utils.SignatureFromString(tx.Signature)
-	bc := h.ns.config.Bc
-
-	isCreated := bc.CreateTransaction(tx.SenderAddress, tx.RecipientAddress, tx.Amount, publicKey, signature)
+	t := tx.Transaction()
+	isCreated := h.ns.config.Bc.CreateTransaction(t)
 
 	if !isCreated {
 		return nil, fmt.Errorf("transaction not created")
 	}
 
-	txData, err := json.Marshal(tx)
-	if err != nil {
-		return nil, errors.Wrap(err, "marshal transaction")
+	if err := h.ns.config.Relay.AnnounceTransaction(t); err != nil {
+		return nil, errors.Wrap(err, "announce transaction")
 	}
-	h.ns.config.PeerManager.BroadcastMessage(ctx, network.NewAddTXMessage(txData))
 
 	return &pb.CreateTransactionResponse{
-		TransactionId: "1",
+		TransactionId: t.HexHash(),
 	}, nil
 }
 
@@ -126,12 +138,103 @@ func (h *NodeHandler) GetTransaction(ctx context.Context, req *pb.GetTransaction
 		Id:               tx.HexHash(),
 		SenderAddress:    tx.SenderAddress,
 		RecipientAddress: tx.RecipientAddress,
-		Amount:           tx.Amount,
+		Amount:           uint64(tx.Amount),
+		Inputs:           inputsToPb(tx.Inputs),
+		Outputs:          outputsToPb(tx.Outputs),
+		Nonce:            tx.Nonce,
+		ChainId:          tx.ChainId,
+		Fee:              uint64(tx.Fee),
+	}, nil
+}
+
+func (h *NodeHandler) GetTransactionProof(ctx context.Context, req *pb.GetTransactionProofRequest) (*pb.GetTransactionProofResponse, error) {
+	tx, loc, err := h.ns.config.Bc.GetTransactionLocation(req.GetHash())
+	if err != nil {
+		return nil, err
+	}
+	b, err := h.ns.config.Bc.GetBlockByHash(fmt.Sprintf("%x", loc.BlockHash))
+	if err != nil {
+		return nil, err
+	}
+	proof, err := b.TransactionProof(loc.Index)
+	if err != nil {
+		return nil, errors.Wrap(err, "transaction proof")
+	}
+	header, err := b.Header.MarshalBinary()
+	if err != nil {
+		return nil, errors.Wrap(err, "encode header")
+	}
+	txData, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, errors.Wrap(err, "encode transaction")
+	}
+
+	return &pb.GetTransactionProofResponse{
+		Header:      header,
+		Transaction: txData,
+		Index:       uint32(proof.Index),
+		Hashes:      proof.Hashes,
+		Height:      uint64(loc.Height),
+	}, nil
+}
+
+func (h *NodeHandler) GetHeaders(ctx context.Context, req *pb.GetHeadersRequest) (*pb.GetHeadersResponse, error) {
+	locator := make([][32]byte, 0, len(req.GetLocator()))
+	for _, l := range req.GetLocator() {
+		if len(l) != 32 {
+			return nil, fmt.Errorf("invalid locator hash %x", l)
+		}
+		var hash [32]byte
+		copy(hash[:], l)
+		locator = append(locator, hash)
+	}
+
+	headers := h.ns.config.Bc.HeadersAfter(locator, int(req.GetMax()))
+	resp := &pb.GetHeadersResponse{Headers: make([][]byte, 0, len(headers))}
+	for _, header := range headers {
+		data, err := header.MarshalBinary()
+		if err != nil {
+			return nil, errors.Wrap(err, "encode header")
+		}
+		resp.Headers = append(resp.Headers, data)
+	}
+	return resp, nil
+}
+
+func (h *NodeHandler) GetAddressTransactions(ctx context.Context, req *pb.GetAddressTransactionsRequest) (*pb.GetAddressTransactionsResponse, error) {
+	ids := h.ns.config.Bc.AddressTransactions(req.GetAddress())
+	hashes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		hashes = append(hashes, fmt.Sprintf("%x", id))
+	}
+	return &pb.GetAddressTransactionsResponse{Hashes: hashes}, nil
+}
+
+func (h *NodeHandler) GetSyncStatus(ctx context.Context, req *pb.GetSyncStatusRequest) (*pb.GetSyncStatusResponse, error) {
+	syncer := h.ns.config.Syncer
+	if syncer == nil {
+		return &pb.GetSyncStatusResponse{
+			State:  string(network.SYNC_IDLE),
+			Height: uint64(h.ns.config.Bc.Height()),
+		}, nil
+	}
+	status := syncer.Status()
+	return &pb.GetSyncStatusResponse{
+		State:        string(status.State),
+		Peer:         status.Peer,
+		StartHeight:  uint64(status.StartHeight),
+		Height:       uint64(status.Height),
+		HeaderHeight: uint64(status.HeaderHeight),
+		TargetHeight: uint64(status.TargetHeight),
+		LastError:    status.LastError,
 	}, nil
 }
 
 func (h *NodeHandler) StartMining(ctx context.Context, req *pb.StartMiningRequest) (*pb.StartMiningResponse, error) {
 	minerAddress := req.GetMinerAddress()
+	if err := utils.ValidateAddress(minerAddress); err != nil {
+		return nil, fmt.Errorf("invalid miner address %q: %w", minerAddress, err)
+	}
 	h.ns.config.Miner.SetMinerAddress(minerAddress)
 	h.ns.config.Miner.StartMining()
 
@@ -153,6 +256,88 @@ func (h *NodeHandler) GetBalance(ctx context.Context, req *pb.GetBalanceRequest)
 	balance := h.ns.config.Bc.Balance(address)
 
 	return &pb.GetBalanceResponse{
-		Balance: balance,
+		Balance: uint64(balance),
 	}, nil
 }
+
+func (h *NodeHandler) GetUnspentOutputs(ctx context.Context, req *pb.GetUnspentOutputsRequest) (*pb.GetUnspentOutputsResponse, error) {
+	unspent, err := h.ns.config.Bc.UnspentOutputs(req.GetAddress())
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]*pb.UnspentOutput, 0, len(unspent))
+	for _, u := range unspent {
+		outputs = append(outputs, &pb.UnspentOutput{
+			TxId:   fmt.Sprintf("%x", u.TxId),
+			Index:  u.Index,
+			Amount: uint64(u.Amount),
+		})
+	}
+
+	return &pb.GetUnspentOutputsResponse{
+		Outputs: outputs,
+	}, nil
+}
+
+func (h *NodeHandler) GetNonce(ctx context.Context, req *pb.GetNonceRequest) (*pb.GetNonceResponse, error) {
+	nonce, err := h.ns.config.Bc.NextNonce(req.GetAddress())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetNonceResponse{
+		Nonce: nonce,
+	}, nil
+}
+
+func (h *NodeHandler) EstimateFee(ctx context.Context, req *pb.EstimateFeeRequest) (*pb.EstimateFeeResponse, error) {
+	return &pb.EstimateFeeResponse{
+		FeeRate:      uint64(h.ns.config.Bc.EstimateFeeRate()),
+		FeeRateBytes: transaction.FEE_RATE_BYTES,
+	}, nil
+}
+
+func inputsFromPb(inputs []*pb.TransactionInput) ([]transaction.Input, error) {
+	var ins []transaction.Input
+	for _, in := range inputs {
+		id, err := hex.DecodeString(in.GetTxId())
+		if err != nil || len(id) != 32 {
+			return nil, fmt.Errorf("invalid input transaction id %q", in.GetTxId())
+		}
+		var txId [32]byte
+		copy(txId[:], id)
+		ins = append(ins, transaction.Input{TxId: txId, Index: in.GetIndex()})
+	}
+	return ins, nil
+}
+
+func inputsToPb(ins []transaction.Input) []*pb.TransactionInput {
+	var inputs []*pb.TransactionInput
+	for _, in := range ins {
+		inputs = append(inputs, &pb.TransactionInput{
+			TxId:  fmt.Sprintf("%x", in.TxId),
+			Index: in.Index,
+		})
+	}
+	return inputs
+}
+
+func outputsFromPb(outputs []*pb.TransactionOutput) []transaction.Output {
+	var outs []transaction.Output
+	for _, out := range outputs {
+		outs = append(outs, transaction.Output{Address: out.GetAddress(), Amount: transaction.Amount(out.GetAmount())})
+	}
+	return outs
+}
+
+func outputsToPb(outs []transaction.Output) []*pb.TransactionOutput {
+	var outputs []*pb.TransactionOutput
+	for _, out := range outs {
+		outputs = append(outputs, &pb.TransactionOutput{
+			Address: out.Address,
+			Amount:  uint64(out.Amount),
+		})
+	}
+	return outputs
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/fr13n8/go-blockchain/blockchain"
 	pb "github.com/fr13n8/go-blockchain/gen/node"
 	"github.com/fr13n8/go-blockchain/miner"
+	"github.com/fr13n8/go-blockchain/network"
 	"github.com/fr13n8/go-blockchain/network/peer-manager"
 	"google.golang.org/grpc"
 	"log"
@@ -19,6 +20,8 @@ type Config struct {
 	Miner *miner.Miner
 
 	PeerManager *peer_manager.PeerManager
+	Syncer      *network.Syncer
+	Relay       *network.Relay
 }
 
 func NewConfig() *Config {
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"fmt"
+	"path/filepath"
+
 	"github.com/fr13n8/go-blockchain/block"
 	"github.com/fr13n8/go-blockchain/block-explorer"
 	"github.com/fr13n8/go-blockchain/blockchain"
@@ -8,8 +11,40 @@ import (
 	"github.com/fr13n8/go-blockchain/network"
 	peer_manager "github.com/fr13n8/go-blockchain/network/peer-manager"
 	"github.com/fr13n8/go-blockchain/node"
+	"github.com/fr13n8/go-blockchain/storage"
+	"github.com/libp2p/go-libp2p/core/crypto"
 )
 
+type Config struct {
+	Storage *storage.Config
+	Chain   *blockchain.Config
+	// IdentityKeyType is the type of the key generated for a node that has
+	// no identity in its data directory yet.
+	IdentityKeyType string
+	// GossipSub propagates blocks and transactions over GossipSub rather than
+	// the peer sessions.
+	GossipSub bool
+	// DHT and MDNS select how peers are discovered, see network.Config.
+	DHT  bool
+	MDNS bool
+	// MinPeers and MaxPeers are the peer watermarks, see network.Config.
+	MinPeers int
+	MaxPeers int
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Storage:         storage.NewConfig(),
+		Chain:           blockchain.NewConfig(),
+		IdentityKeyType: network.KEY_TYPE_ED25519,
+		GossipSub:       true,
+		DHT:             true,
+		MDNS:            true,
+		MinPeers:        peer_manager.MIN_PEERS,
+		MaxPeers:        peer_manager.MAX_PEERS,
+	}
+}
+
 type Server struct {
 	BlockExplorer *block_explorer.Server
 	PeerDiscovery *network.Server
@@ -20,22 +55,61 @@ type Server struct {
 	PeerManager *peer_manager.PeerManager
 }
 
-func NewServer() *Server {
-	bc := blockchain.NewBlockChain()
+func NewServer(cfg *Config) (*Server, error) {
+	if cfg.MinPeers < 1 || cfg.MaxPeers < cfg.MinPeers {
+		return nil, fmt.Errorf("peer watermarks must satisfy 1 <= min (%d) <= max (%d)", cfg.MinPeers, cfg.MaxPeers)
+	}
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
 	solver := block.NewSHA256Solver()
+	bc, err := blockchain.NewBlockChain(cfg.Chain, store, solver)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
 	m := miner.NewMiner(solver, bc)
-	pm := peer_manager.NewPeerManager()
+	// bans and the identity are only kept on disk along with the chain
+	banPath := ""
+	var identity crypto.PrivKey
+	if cfg.Storage.Backend == storage.BACKEND_BOLT {
+		banPath = filepath.Join(cfg.Storage.DataDir, peer_manager.BAN_FILE_NAME)
+		identity, err = network.LoadOrCreateIdentity(network.IdentityPath(cfg.Storage.DataDir), cfg.IdentityKeyType)
+		if err != nil {
+			bc.Close()
+			return nil, err
+		}
+	}
+	bans, err := peer_manager.NewBanList(banPath)
+	if err != nil {
+		bc.Close()
+		return nil, err
+	}
+	pm := peer_manager.NewPeerManager(bans, cfg.MaxPeers)
 
 	pdCfg := network.NewConfig()
 	pdCfg.PeerManager = pm
+	pdCfg.BanList = bans
+	pdCfg.Identity = identity
+	pdCfg.GossipSub = cfg.GossipSub
+	pdCfg.DHT = cfg.DHT
+	pdCfg.MDNS = cfg.MDNS
+	pdCfg.MinPeers = cfg.MinPeers
+	pdCfg.MaxPeers = cfg.MaxPeers
 	pdCfg.Bc = bc
 	pdCfg.Miner = m
+	pdCfg.Syncer = network.NewSyncer(bc, pm)
+	pdCfg.Relay = network.NewRelay(bc, pm, pdCfg.Syncer)
+	m.Subscribe(pdCfg.Relay.AnnounceBlock)
 	pd := network.NewServer(pdCfg)
 
 	nCfg := node.NewConfig()
 	nCfg.Bc = bc
 	nCfg.Miner = m
 	nCfg.PeerManager = pm
+	nCfg.Syncer = pdCfg.Syncer
+	nCfg.Relay = pdCfg.Relay
 	ns := node.NewServer(nCfg)
 
 	beCfg := block_explorer.NewConfig(ns.Addr().String())
@@ -45,5 +119,12 @@ func NewServer() *Server {
 		BlockExplorer: be,
 		PeerDiscovery: pd,
 		NodeServer:    ns,
-	}
+		Bc:            bc,
+		Miner:         m,
+		PeerManager:   pm,
+	}, nil
+}
+
+func (s *Server) Close() error {
+	return s.Bc.Close()
 }
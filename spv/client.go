@@ -0,0 +1,303 @@
+// Package spv implements a light client that keeps only block headers. It
+// validates their linkage, timestamps and proof of work itself and checks
+// transactions and balances against them with merkle proofs, so that it does
+// not have to trust the node it talks to. A node can still hide transactions
+// from the client, but it cannot make it accept one that is not part of the
+// chain.
+package spv
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/blockchain"
+	pb "github.com/fr13n8/go-blockchain/gen/node"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+// MAX_PROOF_HASHES is the depth of the merkle tree of a block with as many
+// transactions as a proof index can address.
+const MAX_PROOF_HASHES = 32
+
+type Config struct {
+	// GenesisHash is the hash of the genesis block of the chain. If it is
+	// zero, the genesis block of the development network is expected.
+	GenesisHash [32]byte
+}
+
+func NewConfig() *Config {
+	return &Config{
+		GenesisHash: defaultGenesisHash(),
+	}
+}
+
+func defaultGenesisHash() [32]byte {
+	hash, err := blockchain.DefaultGenesis().Hash()
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// Client is a header-only view of the heaviest chain a node has shown it.
+type Client struct {
+	nc          pb.NodeServiceClient
+	genesisHash [32]byte
+	// headers, hashes and work are indexed by height. work is the cumulative
+	// proof of work up to each header.
+	headers []*block.Header
+	hashes  [][32]byte
+	work    []*big.Int
+	index   map[[32]byte]int
+	mux     sync.Mutex
+}
+
+func NewClient(nc pb.NodeServiceClient, cfg *Config) *Client {
+	genesisHash := cfg.GenesisHash
+	if genesisHash == [32]byte{} {
+		genesisHash = defaultGenesisHash()
+	}
+	return &Client{
+		nc:          nc,
+		genesisHash: genesisHash,
+		index:       make(map[[32]byte]int),
+	}
+}
+
+// Height returns the height of the best verified header, -1 before the first
+// sync.
+func (c *Client) Height() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.headers) - 1
+}
+
+// Sync downloads the headers the node has beyond the best verified header and
+// adds them if they are valid. A branch that replaces verified headers is only
+// accepted if it has more cumulative work.
+func (c *Client) Sync(ctx context.Context) error {
+	for {
+		resp, err := c.nc.GetHeaders(ctx, &pb.GetHeadersRequest{
+			Locator: c.locator(),
+			Max:     blockchain.MAX_HEADERS,
+		})
+		if err != nil {
+			return fmt.Errorf("get headers: %w", err)
+		}
+		if len(resp.GetHeaders()) == 0 {
+			return nil
+		}
+		headers := make([]*block.Header, 0, len(resp.GetHeaders()))
+		for _, data := range resp.GetHeaders() {
+			h := &block.Header{}
+			if err := h.UnmarshalBinary(data); err != nil {
+				return err
+			}
+			headers = append(headers, h)
+		}
+		added, err := c.connect(headers)
+		if err != nil {
+			return err
+		}
+		if !added || len(headers) < blockchain.MAX_HEADERS {
+			return nil
+		}
+	}
+}
+
+// locator returns hashes of the verified headers from the best one back to
+// the genesis header, dense at first and then exponentially sparser.
+func (c *Client) locator() [][]byte {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var locator [][]byte
+	step := 1
+	for height := len(c.hashes) - 1; height > 0; height -= step {
+		locator = append(locator, c.hashes[height][:])
+		if len(locator) >= blockchain.LOCATOR_DENSE {
+			step *= 2
+		}
+	}
+	if len(c.hashes) > 0 {
+		locator = append(locator, c.hashes[0][:])
+	}
+	return locator
+}
+
+// connect validates headers, which must follow a verified header or start at
+// the genesis block, and makes them the best chain if it has more work. It
+// reports whether they were added.
+func (c *Client) connect(headers []*block.Header) (bool, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	fork := -1
+	if prev := headers[0].PreviousHash; prev != [32]byte{} {
+		height, ok := c.index[prev]
+		if !ok {
+			return false, fmt.Errorf("headers do not connect to the verified chain")
+		}
+		fork = height
+	}
+
+	chain := append([]*block.Header(nil), c.headers[:fork+1]...)
+	hashes := append([][32]byte(nil), c.hashes[:fork+1]...)
+	work := append([]*big.Int(nil), c.work[:fork+1]...)
+	for _, h := range headers {
+		hash := h.ComputeHash()
+		if err := c.checkHeader(chain, hashes, h, hash); err != nil {
+			return false, fmt.Errorf("header %x at height %d: %w", hash, len(chain), err)
+		}
+		w := blockchain.CalcWork(h.Target)
+		if len(work) > 0 {
+			w.Add(w, work[len(work)-1])
+		}
+		chain = append(chain, h)
+		hashes = append(hashes, hash)
+		work = append(work, w)
+	}
+
+	if len(c.work) > 0 && work[len(work)-1].Cmp(c.work[len(c.work)-1]) <= 0 {
+		return false, nil
+	}
+	if fork < len(c.headers)-1 && len(c.headers) > 0 {
+		log.Printf("[SPV] Reorganizing headers above height %d\n", fork)
+	}
+	for _, hash := range c.hashes[fork+1:] {
+		delete(c.index, hash)
+	}
+	for height := fork + 1; height < len(hashes); height++ {
+		c.index[hashes[height]] = height
+	}
+	c.headers, c.hashes, c.work = chain, hashes, work
+	log.Printf("[SPV] Verified headers up to %x at height %d\n", hashes[len(hashes)-1], len(hashes)-1)
+	return true, nil
+}
+
+// checkHeader validates h with the given hash on top of chain.
+func (c *Client) checkHeader(chain []*block.Header, hashes [][32]byte, h *block.Header, hash [32]byte) error {
+	if t := block.CompactToBig(h.Target); t.Sign() <= 0 || t.Cmp(block.CompactToBig(blockchain.POW_LIMIT)) > 0 {
+		return fmt.Errorf("target %08x is outside of the range allowed by the proof of work limit %08x", h.Target, blockchain.POW_LIMIT)
+	}
+	if len(chain) == 0 {
+		if hash != c.genesisHash {
+			return fmt.Errorf("genesis block does not match %x", c.genesisHash)
+		}
+		return nil
+	}
+	if h.PreviousHash != hashes[len(hashes)-1] {
+		return fmt.Errorf("previous hash %x does not match %x", h.PreviousHash, hashes[len(hashes)-1])
+	}
+	if mtp := blockchain.MedianHeaderTime(chain); h.Timestamp <= mtp {
+		return fmt.Errorf("timestamp %d is not after median time past %d", h.Timestamp, mtp)
+	}
+	if h.Timestamp > time.Now().Add(blockchain.MAX_FUTURE_BLOCK_TIME).UnixNano() {
+		return fmt.Errorf("timestamp %d is too far in the future", h.Timestamp)
+	}
+	if target := blockchain.RequiredHeaderTarget(chain); h.Target != target {
+		return fmt.Errorf("target %08x does not match required target %08x", h.Target, target)
+	}
+	if utils.HashToBig(&hash).Cmp(block.CompactToBig(h.Target)) > 0 {
+		return fmt.Errorf("hash does not satisfy target %08x", h.Target)
+	}
+	return nil
+}
+
+// VerifyTransaction fetches the transaction with the given hash and its
+// merkle proof and checks it against the verified headers. It returns the
+// transaction and the height of the block that includes it.
+func (c *Client) VerifyTransaction(ctx context.Context, hash string) (*transaction.Transaction, int, error) {
+	resp, err := c.nc.GetTransactionProof(ctx, &pb.GetTransactionProofRequest{Hash: hash})
+	if err != nil {
+		return nil, 0, fmt.Errorf("get transaction proof: %w", err)
+	}
+	var header block.Header
+	if err := header.UnmarshalBinary(resp.GetHeader()); err != nil {
+		return nil, 0, err
+	}
+	t := &transaction.Transaction{}
+	if err := t.UnmarshalBinary(resp.GetTransaction()); err != nil {
+		return nil, 0, err
+	}
+	if t.HexHash() != hash {
+		return nil, 0, fmt.Errorf("node returned transaction %s instead of %s", t.HexHash(), hash)
+	}
+
+	c.mux.Lock()
+	known := resp.GetHeight() < uint64(len(c.hashes)) && c.hashes[resp.GetHeight()] == header.Hash
+	c.mux.Unlock()
+	if !known {
+		return nil, 0, fmt.Errorf("block %x at height %d is not part of the verified headers", header.Hash, resp.GetHeight())
+	}
+	height := int(resp.GetHeight())
+
+	hashes := resp.GetHashes()
+	if len(hashes) > MAX_PROOF_HASHES || uint64(resp.GetIndex()) >= 1<<len(hashes) {
+		return nil, 0, fmt.Errorf("transaction index %d is out of range of a proof of %d hashes", resp.GetIndex(), len(hashes))
+	}
+	proof := &utils.MerkleProof{Index: int(resp.GetIndex()), Hashes: hashes}
+	if err := block.VerifyTransactionProof(&header, t, proof); err != nil {
+		return nil, 0, err
+	}
+	return t, height, nil
+}
+
+// Balance returns the balance of address computed from its transaction
+// history, every transaction of which is verified with a merkle proof. Sync
+// should be called first so that recent transactions can be verified.
+func (c *Client) Balance(ctx context.Context, address string) (transaction.Amount, error) {
+	resp, err := c.nc.GetAddressTransactions(ctx, &pb.GetAddressTransactionsRequest{Address: address})
+	if err != nil {
+		return 0, fmt.Errorf("get address transactions: %w", err)
+	}
+
+	var received, sent transaction.Amount
+	var nonces []uint64
+	seen := make(map[string]struct{}, len(resp.GetHashes()))
+	for _, hash := range resp.GetHashes() {
+		if _, err := hex.DecodeString(hash); err != nil {
+			return 0, fmt.Errorf("invalid transaction hash %q", hash)
+		}
+		if _, ok := seen[hash]; ok {
+			return 0, fmt.Errorf("transaction %s is listed twice", hash)
+		}
+		seen[hash] = struct{}{}
+
+		t, _, err := c.VerifyTransaction(ctx, hash)
+		if err != nil {
+			return 0, err
+		}
+		for _, out := range t.Outs() {
+			if out.Address == address {
+				received += out.Amount
+			}
+		}
+		if t.SenderAddress == address {
+			sent += t.Value() + t.Fee
+			if t.Nonce > 0 {
+				nonces = append(nonces, t.Nonce)
+			}
+		}
+	}
+
+	// the account ledger numbers the transactions of a sender from one, so
+	// a gap shows that the node left some of them out
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	for i, nonce := range nonces {
+		if nonce != uint64(i+1) {
+			return 0, fmt.Errorf("transaction history of %s is incomplete: nonce %d is missing", address, i+1)
+		}
+	}
+	if sent > received {
+		return 0, fmt.Errorf("transaction history of %s is incomplete: %s sent but %s received", address, sent, received)
+	}
+	return received - sent, nil
+}
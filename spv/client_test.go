@@ -0,0 +1,390 @@
+package spv
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fr13n8/go-blockchain/block"
+	"github.com/fr13n8/go-blockchain/blockchain"
+	pb "github.com/fr13n8/go-blockchain/gen/node"
+	"github.com/fr13n8/go-blockchain/storage"
+	"github.com/fr13n8/go-blockchain/transaction"
+	"github.com/fr13n8/go-blockchain/utils"
+	"google.golang.org/grpc"
+)
+
+// node serves the requests of the client from bc the way the node handler
+// does. tamper, if set, changes every transaction proof before it is returned.
+type node struct {
+	pb.NodeServiceClient
+	bc     *blockchain.BlockChain
+	tamper func(*pb.GetTransactionProofResponse)
+}
+
+func (n *node) GetHeaders(ctx context.Context, req *pb.GetHeadersRequest, opts ...grpc.CallOption) (*pb.GetHeadersResponse, error) {
+	locator := make([][32]byte, 0, len(req.GetLocator()))
+	for _, l := range req.GetLocator() {
+		var hash [32]byte
+		copy(hash[:], l)
+		locator = append(locator, hash)
+	}
+	resp := &pb.GetHeadersResponse{}
+	for _, header := range n.bc.HeadersAfter(locator, int(req.GetMax())) {
+		data, err := header.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		resp.Headers = append(resp.Headers, data)
+	}
+	return resp, nil
+}
+
+func (n *node) GetTransactionProof(ctx context.Context, req *pb.GetTransactionProofRequest, opts ...grpc.CallOption) (*pb.GetTransactionProofResponse, error) {
+	tx, loc, err := n.bc.GetTransactionLocation(req.GetHash())
+	if err != nil {
+		return nil, err
+	}
+	b, err := n.bc.GetBlockByHash(fmt.Sprintf("%x", loc.BlockHash))
+	if err != nil {
+		return nil, err
+	}
+	proof, err := b.TransactionProof(loc.Index)
+	if err != nil {
+		return nil, err
+	}
+	header, err := b.Header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	txData, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetTransactionProofResponse{
+		Header:      header,
+		Transaction: txData,
+		Index:       uint32(proof.Index),
+		Hashes:      proof.Hashes,
+		Height:      uint64(loc.Height),
+	}
+	if n.tamper != nil {
+		n.tamper(resp)
+	}
+	return resp, nil
+}
+
+func (n *node) GetAddressTransactions(ctx context.Context, req *pb.GetAddressTransactionsRequest, opts ...grpc.CallOption) (*pb.GetAddressTransactionsResponse, error) {
+	resp := &pb.GetAddressTransactionsResponse{}
+	for _, id := range n.bc.AddressTransactions(req.GetAddress()) {
+		resp.Hashes = append(resp.Hashes, fmt.Sprintf("%x", id))
+	}
+	return resp, nil
+}
+
+type testKey struct {
+	key     *ecdsa.PrivateKey
+	address string
+}
+
+func newKey(t *testing.T) *testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKey{key: key, address: utils.AddressFromPublicKey(&key.PublicKey)}
+}
+
+// transfer returns a transfer of amount from k to recipient signed for the
+// chain of testGenesis.
+func (k *testKey) transfer(t *testing.T, recipient string, amount transaction.Amount, nonce uint64) *transaction.Transaction {
+	t.Helper()
+	tx := &transaction.Transaction{
+		ChainId:          "test",
+		SenderAddress:    k.address,
+		SenderPublicKey:  &k.key.PublicKey,
+		RecipientAddress: recipient,
+		Amount:           amount,
+		Fee:              transaction.COIN / 10,
+		Nonce:            nonce,
+	}
+	h, err := tx.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = &utils.Signature{R: r, S: s}
+	tx.Signature.NormalizeS(elliptic.P256())
+	tx.Id = h
+	return tx
+}
+
+func testGenesis(allocations ...blockchain.Allocation) *blockchain.Genesis {
+	return &blockchain.Genesis{
+		ChainId:     "test",
+		Timestamp:   time.Now().Add(-time.Hour).Truncate(time.Second),
+		Target:      "1f00ffff",
+		Allocations: allocations,
+	}
+}
+
+// newTestChain creates a chain on the memory store whose blocks need real
+// proof of work, which the client checks.
+func newTestChain(t *testing.T, genesis *blockchain.Genesis) *blockchain.BlockChain {
+	t.Helper()
+	store, err := storage.Open(&storage.Config{Backend: storage.BACKEND_MEMORY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := blockchain.NewConfig()
+	cfg.Genesis = genesis
+	bc, err := blockchain.NewBlockChain(cfg, store, block.NewSHA256Solver())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Close() })
+	return bc
+}
+
+// mine mines n blocks with the pooled transactions on top of the tip of bc,
+// each a block time after its parent.
+func mine(t *testing.T, bc *blockchain.BlockChain, n int, miner string) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		b := bc.BlockTemplate(miner)
+		b.Timestamp = bc.LastBlock().Timestamp + int64(blockchain.TARGET_BLOCK_TIME)
+		if !block.NewSHA256Solver().Solve(b) {
+			t.Fatal("no nonce solves the block")
+		}
+		if err := bc.CreateBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestClient(t *testing.T, n *node, genesis *blockchain.Genesis) *Client {
+	t.Helper()
+	hash, err := genesis.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(n, &Config{GenesisHash: hash})
+}
+
+func TestClientVerifiesTransactions(t *testing.T) {
+	alice, bob, miner := newKey(t), newKey(t), newKey(t)
+	const funds = 10 * transaction.COIN
+	genesis := testGenesis(blockchain.Allocation{Address: alice.address, Amount: funds})
+	bc := newTestChain(t, genesis)
+	tx := alice.transfer(t, bob.address, 3*transaction.COIN, 1)
+	if !bc.CreateTransaction(tx) {
+		t.Fatal("transfer was not pooled")
+	}
+	mine(t, bc, 3, miner.address)
+
+	n := &node{bc: bc}
+	c := newTestClient(t, n, genesis)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Height(); got != 3 {
+		t.Fatalf("Height = %d, want 3", got)
+	}
+
+	got, height, err := c.VerifyTransaction(context.Background(), tx.HexHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != tx.Id || height != 1 {
+		t.Fatalf("VerifyTransaction = %s at height %d, want %s at height 1", got.HexHash(), height, tx.HexHash())
+	}
+	balances := map[string]transaction.Amount{
+		alice.address: funds - tx.Amount - tx.Fee,
+		bob.address:   tx.Amount,
+	}
+	for address, want := range balances {
+		balance, err := c.Balance(context.Background(), address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != want {
+			t.Fatalf("Balance(%s) = %s, want %s", address, balance, want)
+		}
+	}
+
+	other, err := bc.GetBlockByHash(fmt.Sprintf("%x", bc.LastBlock().Hash()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHeader, err := other.Header.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		tamper func(resp *pb.GetTransactionProofResponse)
+	}{
+		{"other height", func(resp *pb.GetTransactionProofResponse) { resp.Height = 2 }},
+		{"height past the headers", func(resp *pb.GetTransactionProofResponse) { resp.Height = 4 }},
+		{"other block", func(resp *pb.GetTransactionProofResponse) { resp.Header, resp.Height = otherHeader, 3 }},
+		{"other index", func(resp *pb.GetTransactionProofResponse) { resp.Index ^= 1 }},
+		{"index out of range", func(resp *pb.GetTransactionProofResponse) { resp.Index = 1 << len(resp.Hashes) }},
+		{"missing hash", func(resp *pb.GetTransactionProofResponse) { resp.Hashes = resp.Hashes[:len(resp.Hashes)-1] }},
+		{"too many hashes", func(resp *pb.GetTransactionProofResponse) {
+			resp.Hashes = make([][]byte, MAX_PROOF_HASHES+1)
+		}},
+		{"other transaction", func(resp *pb.GetTransactionProofResponse) {
+			data, err := alice.transfer(t, bob.address, 4*transaction.COIN, 1).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Transaction = data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n.tamper = tt.tamper
+			defer func() { n.tamper = nil }()
+			if _, _, err := c.VerifyTransaction(context.Background(), tx.HexHash()); err == nil {
+				t.Fatal("tampered proof verifies")
+			}
+			if _, err := c.Balance(context.Background(), bob.address); err == nil {
+				t.Fatal("balance with a tampered proof succeeded")
+			}
+		})
+	}
+}
+
+func TestClientReorganizes(t *testing.T) {
+	alice, bob, miner := newKey(t), newKey(t), newKey(t)
+	genesis := testGenesis(blockchain.Allocation{Address: alice.address, Amount: 10 * transaction.COIN})
+	short, long := newTestChain(t, genesis), newTestChain(t, genesis)
+	tx := alice.transfer(t, bob.address, transaction.COIN, 1)
+	if !short.CreateTransaction(tx) {
+		t.Fatal("transfer was not pooled")
+	}
+	mine(t, short, 3, miner.address)
+	mine(t, long, 5, miner.address)
+
+	n := &node{bc: short}
+	c := newTestClient(t, n, genesis)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.VerifyTransaction(context.Background(), tx.HexHash()); err != nil {
+		t.Fatal(err)
+	}
+
+	n.bc = long
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Height(); got != 5 {
+		t.Fatalf("Height after the reorganization = %d, want 5", got)
+	}
+	if c.hashes[5] != long.LastBlock().Hash() {
+		t.Fatal("best header is not the tip of the longer chain")
+	}
+
+	// the transfer is only part of the abandoned branch
+	n.bc = short
+	if _, _, err := c.VerifyTransaction(context.Background(), tx.HexHash()); err == nil {
+		t.Fatal("transaction of the abandoned branch verifies")
+	}
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Height(); got != 5 || c.hashes[5] != long.LastBlock().Hash() {
+		t.Fatal("branch with less work replaced the best headers")
+	}
+}
+
+func TestClientRejectsHeaders(t *testing.T) {
+	miner := newKey(t)
+	genesis := testGenesis()
+	bc := newTestChain(t, genesis)
+	mine(t, bc, 3, miner.address)
+	c := newTestClient(t, &node{bc: bc}, genesis)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var headers []*block.Header
+	for _, b := range bc.GetBlocks() {
+		headers = append(headers, &b.Header)
+	}
+	tip := headers[len(headers)-1]
+	tests := []struct {
+		name   string
+		modify func(h *block.Header)
+		valid  bool
+	}{
+		{
+			name:   "valid",
+			modify: func(h *block.Header) {},
+			valid:  true,
+		},
+		{
+			name:   "timestamp at median time past",
+			modify: func(h *block.Header) { h.Timestamp = blockchain.MedianHeaderTime(headers) },
+		},
+		{
+			name: "timestamp too far in the future",
+			modify: func(h *block.Header) {
+				h.Timestamp = time.Now().Add(blockchain.MAX_FUTURE_BLOCK_TIME + time.Minute).UnixNano()
+			},
+		},
+		{
+			name:   "other target",
+			modify: func(h *block.Header) { h.Target = 0x1e00ffff },
+		},
+		{
+			name:   "target above the proof of work limit",
+			modify: func(h *block.Header) { h.Target = 0x2000ffff },
+		},
+		{
+			name:   "unknown parent",
+			modify: func(h *block.Header) { h.PreviousHash = [32]byte{1} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := block.New(0, tip.ComputeHash(), blockchain.RequiredHeaderTarget(headers), nil)
+			b.Timestamp = tip.Timestamp + int64(blockchain.TARGET_BLOCK_TIME)
+			tt.modify(&b.Header)
+			if !block.NewSHA256Solver().Solve(b) {
+				t.Fatal("no nonce solves the header")
+			}
+			h := b.Header
+			added, err := c.connect([]*block.Header{&h})
+			if (err == nil) != tt.valid || added != tt.valid {
+				t.Fatalf("connect = %t, %v, want valid %t", added, err, tt.valid)
+			}
+			if tt.valid {
+				// drop the header again for the next case
+				c.headers, c.hashes, c.work = c.headers[:4], c.hashes[:4], c.work[:4]
+				delete(c.index, h.Hash)
+			}
+		})
+	}
+
+	// a header that does not meet its target
+	b := block.New(0, tip.ComputeHash(), blockchain.RequiredHeaderTarget(headers), nil)
+	b.Timestamp = tip.Timestamp + int64(blockchain.TARGET_BLOCK_TIME)
+	for b.Header.Nonce = 0; ; b.Header.Nonce++ {
+		if hash := b.Header.ComputeHash(); utils.HashToBig(&hash).Cmp(block.CompactToBig(b.Header.Target)) > 0 {
+			break
+		}
+	}
+	if _, err := c.connect([]*block.Header{&b.Header}); err == nil {
+		t.Fatal("header without proof of work was accepted")
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Get(bucket, key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get(key)
+		if v == nil {
+			return ErrNotFound
+		}
+		// values returned by bolt are only valid for the life of the transaction
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *BoltStore) Put(bucket, key, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, value)
+	})
+}
+
+func (s *BoltStore) PutAll(entries []Entry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, e := range entries {
+			b, err := tx.CreateBucketIfNotExists(e.Bucket)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(e.Key, e.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Delete(bucket, key []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(key)
+	})
+}
+
+func (s *BoltStore) ForEach(bucket []byte, fn func(key, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(fn)
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
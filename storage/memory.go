@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+type MemoryStore struct {
+	buckets map[string]map[string][]byte
+	l       sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]map[string][]byte),
+	}
+}
+
+func (s *MemoryStore) Get(bucket, key []byte) ([]byte, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	v, ok := s.buckets[string(bucket)][string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (s *MemoryStore) Put(bucket, key, value []byte) error {
+	return s.PutAll([]Entry{{Bucket: bucket, Key: key, Value: value}})
+}
+
+func (s *MemoryStore) PutAll(entries []Entry) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	for _, e := range entries {
+		b, ok := s.buckets[string(e.Bucket)]
+		if !ok {
+			b = make(map[string][]byte)
+			s.buckets[string(e.Bucket)] = b
+		}
+		b[string(e.Key)] = append([]byte{}, e.Value...)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(bucket, key []byte) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.buckets[string(bucket)], string(key))
+	return nil
+}
+
+// ForEach walks the bucket in key order, matching the bolt backend.
+func (s *MemoryStore) ForEach(bucket []byte, fn func(key, value []byte) error) error {
+	s.l.RLock()
+	b := s.buckets[string(bucket)]
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	s.l.RUnlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s.l.RLock()
+		v, ok := b[k]
+		s.l.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
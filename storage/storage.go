@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	BACKEND_BOLT   = "bolt"
+	BACKEND_MEMORY = "memory"
+
+	DATA_DIR_NAME = ".go-blockchain"
+)
+
+var ErrNotFound = errors.New("key not found")
+
+// Store is a bucketed key/value store used to persist chain data.
+type Store interface {
+	Get(bucket, key []byte) ([]byte, error)
+	Put(bucket, key, value []byte) error
+	// PutAll stores every entry or, if it fails, none of them.
+	PutAll(entries []Entry) error
+	Delete(bucket, key []byte) error
+	ForEach(bucket []byte, fn func(key, value []byte) error) error
+	Close() error
+}
+
+// Entry is a value stored under a key of a bucket.
+type Entry struct {
+	Bucket []byte
+	Key    []byte
+	Value  []byte
+}
+
+type Config struct {
+	DataDir string
+	Backend string
+}
+
+func NewConfig() *Config {
+	return &Config{
+		DataDir: DefaultDataDir(),
+		Backend: BACKEND_BOLT,
+	}
+}
+
+func DefaultDataDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return DATA_DIR_NAME
+	}
+	return filepath.Join(home, DATA_DIR_NAME)
+}
+
+func Open(cfg *Config) (Store, error) {
+	switch cfg.Backend {
+	case BACKEND_BOLT:
+		if err := os.MkdirAll(cfg.DataDir, 0o700); err != nil {
+			return nil, fmt.Errorf("create data dir %s: %w", cfg.DataDir, err)
+		}
+		return NewBoltStore(filepath.Join(cfg.DataDir, "chain.db"))
+	case BACKEND_MEMORY:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func openStores(t *testing.T) map[string]Store {
+	t.Helper()
+	stores := make(map[string]Store)
+	for _, backend := range []string{BACKEND_BOLT, BACKEND_MEMORY} {
+		s, err := Open(&Config{DataDir: t.TempDir(), Backend: backend})
+		if err != nil {
+			t.Fatalf("open %s store: %v", backend, err)
+		}
+		t.Cleanup(func() { s.Close() })
+		stores[backend] = s
+	}
+	return stores
+}
+
+func TestStore(t *testing.T) {
+	bucket := []byte("bucket")
+	for backend, s := range openStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			if _, err := s.Get(bucket, []byte("a")); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get from a missing bucket: %v, want ErrNotFound", err)
+			}
+			if err := s.ForEach(bucket, func(k, v []byte) error { return errors.New("called") }); err != nil {
+				t.Fatalf("ForEach over a missing bucket: %v", err)
+			}
+
+			value := []byte("1")
+			if err := s.Put(bucket, []byte("a"), value); err != nil {
+				t.Fatal(err)
+			}
+			// the store keeps its own copy
+			value[0] = '9'
+			if got, err := s.Get(bucket, []byte("a")); err != nil || string(got) != "1" {
+				t.Fatalf("Get = %q, %v, want \"1\"", got, err)
+			}
+			if _, err := s.Get(bucket, []byte("b")); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get of a missing key: %v, want ErrNotFound", err)
+			}
+
+			err := s.PutAll([]Entry{
+				{Bucket: bucket, Key: []byte("c"), Value: []byte("3")},
+				{Bucket: bucket, Key: []byte("b"), Value: []byte("2")},
+				{Bucket: []byte("other"), Key: []byte("a"), Value: []byte("x")},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.Get([]byte("other"), []byte("a")); err != nil || string(got) != "x" {
+				t.Fatalf("Get = %q, %v, want \"x\"", got, err)
+			}
+
+			var keys, values string
+			err = s.ForEach(bucket, func(k, v []byte) error {
+				keys += string(k)
+				values += string(v)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys != "abc" || values != "123" {
+				t.Fatalf("ForEach visited keys %q with values %q, want \"abc\" and \"123\"", keys, values)
+			}
+
+			if err := s.Delete(bucket, []byte("b")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get(bucket, []byte("b")); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get of a deleted key: %v, want ErrNotFound", err)
+			}
+			if err := s.Delete([]byte("missing"), []byte("a")); err != nil {
+				t.Fatalf("Delete from a missing bucket: %v", err)
+			}
+
+			stop := errors.New("stop")
+			n := 0
+			err = s.ForEach(bucket, func(k, v []byte) error {
+				n++
+				return stop
+			})
+			if !errors.Is(err, stop) || n != 1 {
+				t.Fatalf("ForEach returned %v after %d calls, want the error of the first call", err, n)
+			}
+		})
+	}
+}
+
+func TestBoltStorePersists(t *testing.T) {
+	cfg := &Config{DataDir: t.TempDir(), Backend: BACKEND_BOLT}
+	s, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAll([]Entry{{Bucket: []byte("b"), Key: []byte("k"), Value: []byte("v")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, err := s.Get([]byte("b"), []byte("k")); err != nil || string(got) != "v" {
+		t.Fatalf("Get after reopening = %q, %v, want \"v\"", got, err)
+	}
+}
+
+func TestOpenUnknownBackend(t *testing.T) {
+	if _, err := Open(&Config{Backend: "unknown"}); err == nil {
+		t.Fatal("Open of an unknown backend succeeded")
+	}
+}
@@ -0,0 +1,71 @@
+package transaction
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of coins in indivisible base units.
+type Amount uint64
+
+const (
+	AMOUNT_DECIMALS = 8
+	// COIN is the number of base units in one coin.
+	COIN Amount = 100_000_000
+	// MAX_AMOUNT bounds every amount and balance so that sums cannot overflow.
+	MAX_AMOUNT Amount = 21_000_000 * COIN
+)
+
+// ParseAmount parses a decimal coin value such as "1.5" or ".5" into base
+// units. It rejects negative values, values with more than AMOUNT_DECIMALS
+// decimals and a trailing dot, which is more likely a mistyped value than a
+// whole number of coins.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if (whole == "" && !hasFrac) || (hasFrac && frac == "") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > AMOUNT_DECIMALS {
+		return 0, fmt.Errorf("amount %q has more than %d decimals", s, AMOUNT_DECIMALS)
+	}
+
+	var coins, units uint64
+	var err error
+	if whole != "" {
+		if coins, err = strconv.ParseUint(whole, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	if frac != "" {
+		frac += strings.Repeat("0", AMOUNT_DECIMALS-len(frac))
+		if units, err = strconv.ParseUint(frac, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	if coins > uint64(MAX_AMOUNT/COIN) {
+		return 0, fmt.Errorf("amount %q exceeds the maximum of %s", s, MAX_AMOUNT)
+	}
+
+	a := Amount(coins)*COIN + Amount(units)
+	if a > MAX_AMOUNT {
+		return 0, fmt.Errorf("amount %q exceeds the maximum of %s", s, MAX_AMOUNT)
+	}
+	return a, nil
+}
+
+// String formats the amount in coins without trailing zeros, e.g. "1.5".
+func (a Amount) String() string {
+	s := fmt.Sprintf("%d.%0*d", a/COIN, AMOUNT_DECIMALS, a%COIN)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// Add returns a + b, or false if the sum leaves the valid amount range.
+func (a Amount) Add(b Amount) (Amount, bool) {
+	if b > math.MaxUint64-a || a+b > MAX_AMOUNT {
+		return 0, false
+	}
+	return a + b, true
+}
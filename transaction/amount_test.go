@@ -0,0 +1,89 @@
+package transaction
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  Amount
+		valid bool
+	}{
+		{"0", 0, true},
+		{"1", COIN, true},
+		{"1.5", COIN + COIN/2, true},
+		{"0.00000001", 1, true},
+		{".5", COIN / 2, true},
+		{"  2.25 ", 2*COIN + COIN/4, true},
+		{"007.10", 7*COIN + COIN/10, true},
+		{"21000000", MAX_AMOUNT, true},
+		{"21000000.00000000", MAX_AMOUNT, true},
+		{"", 0, false},
+		{" ", 0, false},
+		{".", 0, false},
+		{"1.", 0, false},
+		{"1.2.3", 0, false},
+		{"0.000000001", 0, false},
+		{"-1", 0, false},
+		{"+1", 0, false},
+		{"1.-5", 0, false},
+		{"1e8", 0, false},
+		{"1_000", 0, false},
+		{"0x10", 0, false},
+		{"coin", 0, false},
+		{"21000000.00000001", 0, false},
+		{"21000001", 0, false},
+		{"18446744073709551616", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.s)
+		if tt.valid && (err != nil || got != tt.want) {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("ParseAmount(%q) = %d, want an error", tt.s, got)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		want string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{COIN, "1"},
+		{COIN + COIN/2, "1.5"},
+		{MAX_AMOUNT, "21000000"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", uint64(tt.a), got, tt.want)
+		}
+		if parsed, err := ParseAmount(tt.a.String()); err != nil || parsed != tt.a {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", tt.a.String(), parsed, err, uint64(tt.a))
+		}
+	}
+}
+
+func TestAmountAdd(t *testing.T) {
+	tests := []struct {
+		a, b Amount
+		want Amount
+		ok   bool
+	}{
+		{1, 2, 3, true},
+		{MAX_AMOUNT - 1, 1, MAX_AMOUNT, true},
+		{MAX_AMOUNT, 1, 0, false},
+		{math.MaxUint64, 1, 0, false},
+		{1, math.MaxUint64, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := tt.a.Add(tt.b); got != tt.want || ok != tt.ok {
+			t.Errorf("%d.Add(%d) = %d, %t, want %d, %t", uint64(tt.a), uint64(tt.b), uint64(got), ok, uint64(tt.want), tt.ok)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+
+	"github.com/fr13n8/go-blockchain/codec"
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+const (
+	WITNESS_PUBLIC_KEY = 1 << iota
+	WITNESS_SIGNATURE
+)
+
+const scalarSize = 32
+
+// MarshalBinary returns the canonical encoding of the transaction: the
+// payload followed by the witness. The id is not encoded, it is the hash of
+// the payload.
+func (t *Transaction) MarshalBinary() ([]byte, error) {
+	w := codec.NewWriter()
+	t.encodePayload(w)
+
+	var flags uint8
+	if t.SenderPublicKey != nil {
+		flags |= WITNESS_PUBLIC_KEY
+	}
+	if t.Signature != nil {
+		flags |= WITNESS_SIGNATURE
+	}
+	w.Uint8(flags)
+	if t.SenderPublicKey != nil {
+		if err := writeScalars(w, t.SenderPublicKey.X, t.SenderPublicKey.Y); err != nil {
+			return nil, fmt.Errorf("sender public key: %w", err)
+		}
+	}
+	if t.Signature != nil {
+		if err := writeScalars(w, t.Signature.R, t.Signature.S); err != nil {
+			return nil, fmt.Errorf("signature: %w", err)
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a transaction written by MarshalBinary and sets its
+// id.
+func (t *Transaction) UnmarshalBinary(data []byte) error {
+	r := codec.NewReader(data)
+	if err := t.decode(r); err != nil {
+		return err
+	}
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("decode transaction: %w", err)
+	}
+	id, err := t.Hash()
+	if err != nil {
+		return err
+	}
+	t.Id = id
+	return nil
+}
+
+func (t *Transaction) encodePayload(w *codec.Writer) {
+	w.Version()
+	w.String(t.ChainId)
+	w.String(t.SenderAddress)
+	w.String(t.RecipientAddress)
+	w.Uint64(uint64(t.Amount))
+	w.Uint64(uint64(t.Fee))
+	w.Uint64(t.Nonce)
+	w.Uvarint(uint64(len(t.Inputs)))
+	for _, in := range t.Inputs {
+		w.Fixed(in.TxId[:])
+		w.Uint32(in.Index)
+	}
+	w.Uvarint(uint64(len(t.Outputs)))
+	for _, out := range t.Outputs {
+		w.String(out.Address)
+		w.Uint64(uint64(out.Amount))
+	}
+}
+
+func (t *Transaction) decode(r *codec.Reader) error {
+	r.Version()
+	chainId := r.String()
+	sender := r.String()
+	recipient := r.String()
+	amount := Amount(r.Uint64())
+	fee := Amount(r.Uint64())
+	nonce := r.Uint64()
+
+	var inputs []Input
+	if n := r.Len(32 + 4); n > 0 {
+		inputs = make([]Input, n)
+		for i := range inputs {
+			copy(inputs[i].TxId[:], r.Fixed(32))
+			inputs[i].Index = r.Uint32()
+		}
+	}
+	var outputs []Output
+	if n := r.Len(1 + 8); n > 0 {
+		outputs = make([]Output, n)
+		for i := range outputs {
+			outputs[i].Address = r.String()
+			outputs[i].Amount = Amount(r.Uint64())
+		}
+	}
+
+	flags := r.Uint8()
+	if flags&^(WITNESS_PUBLIC_KEY|WITNESS_SIGNATURE) != 0 {
+		return fmt.Errorf("decode transaction: unknown witness flags %#x", flags)
+	}
+	var publicKey *ecdsa.PublicKey
+	if flags&WITNESS_PUBLIC_KEY != 0 {
+		x, y := readScalars(r)
+		publicKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	}
+	var signature *utils.Signature
+	if flags&WITNESS_SIGNATURE != 0 {
+		sigR, sigS := readScalars(r)
+		signature = &utils.Signature{R: sigR, S: sigS}
+	}
+	if err := r.Err(); err != nil {
+		return fmt.Errorf("decode transaction: %w", err)
+	}
+
+	*t = Transaction{
+		ChainId:          chainId,
+		SenderAddress:    sender,
+		RecipientAddress: recipient,
+		Amount:           amount,
+		Fee:              fee,
+		Nonce:            nonce,
+		Inputs:           inputs,
+		Outputs:          outputs,
+		SenderPublicKey:  publicKey,
+		Signature:        signature,
+	}
+	return nil
+}
+
+func writeScalars(w *codec.Writer, a, b *big.Int) error {
+	for _, x := range []*big.Int{a, b} {
+		if x == nil || x.Sign() < 0 || x.BitLen() > scalarSize*8 {
+			return fmt.Errorf("value does not fit in %d bytes", scalarSize)
+		}
+		w.Fixed(x.FillBytes(make([]byte, scalarSize)))
+	}
+	return nil
+}
+
+func readScalars(r *codec.Reader) (*big.Int, *big.Int) {
+	a := new(big.Int).SetBytes(r.Fixed(scalarSize))
+	b := new(big.Int).SetBytes(r.Fixed(scalarSize))
+	return a, b
+}
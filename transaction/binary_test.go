@@ -0,0 +1,126 @@
+package transaction
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+// signed returns t signed by a new key, with the sender address of the key.
+func signed(t *testing.T, tx *Transaction) *Transaction {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.SenderAddress = utils.AddressFromPublicKey(&key.PublicKey)
+	tx.SenderPublicKey = &key.PublicKey
+	h, err := tx.SigningHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = &utils.Signature{R: r, S: s}
+	tx.Signature.NormalizeS(elliptic.P256())
+	tx.Id = h
+	return tx
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   *Transaction
+	}{
+		{
+			name: "unsigned",
+			tx:   NewTransaction("sender", "recipient", 5),
+		},
+		{
+			name: "account",
+			tx: signed(t, &Transaction{
+				ChainId:          "test",
+				RecipientAddress: "recipient",
+				Amount:           1_000,
+				Fee:              10,
+				Nonce:            3,
+			}),
+		},
+		{
+			name: "utxo",
+			tx: signed(t, &Transaction{
+				ChainId: "test",
+				Fee:     1,
+				Inputs:  []Input{{TxId: [32]byte{1}, Index: 0}, {TxId: [32]byte{2}, Index: 7}},
+				Outputs: []Output{{Address: "a", Amount: 2}, {Address: "b", Amount: 3}},
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.tx.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded Transaction
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			again, err := decoded.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, again) {
+				t.Fatalf("encoding changed after a round trip:\n%x\n%x", data, again)
+			}
+			id, _ := tt.tx.Hash()
+			if decoded.Id != id {
+				t.Fatalf("decoded id %x, want %x", decoded.Id, id)
+			}
+			if tt.tx.Signature != nil {
+				if err := decoded.VerifySignature(); err != nil {
+					t.Fatalf("VerifySignature after a round trip: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnmarshalBinaryRejects(t *testing.T) {
+	data, err := signed(t, &Transaction{ChainId: "test", RecipientAddress: "r", Amount: 1}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unsigned transaction ends with its witness flags
+	unsigned, err := NewTransaction("s", "r", 1).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownFlags := append([]byte(nil), unsigned...)
+	unknownFlags[len(unknownFlags)-1] = 1 << 2
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", data[:len(data)-1]},
+		{"trailing byte", append(append([]byte(nil), data...), 0)},
+		{"unknown version", append([]byte{0xff}, data[1:]...)},
+		{"unknown witness flags", unknownFlags},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tx Transaction
+			if err := tx.UnmarshalBinary(tt.data); err == nil {
+				t.Fatal("UnmarshalBinary succeeded, want an error")
+			}
+		})
+	}
+}
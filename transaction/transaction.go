@@ -1,20 +1,47 @@
 package transaction
 
 import (
+	"crypto/ecdsa"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
+
+	"github.com/fr13n8/go-blockchain/codec"
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+const (
+	// FEE_RATE_BYTES is the size fee rates are expressed for.
+	FEE_RATE_BYTES = 1000
+	// PUBLIC_KEY_SIZE and SIGNATURE_SIZE are the number of bytes the public
+	// key and the signature add to the encoding of a transaction.
+	PUBLIC_KEY_SIZE = 2 * scalarSize
+	SIGNATURE_SIZE  = 2 * scalarSize
 )
 
+// Transaction moves funds from SenderAddress. ChainId binds the signature to
+// one network. Fee is paid by the sender on top of the amount and collected by
+// the miner. Nonce orders the transactions of a sender in the account ledger:
+// the first transaction of an address has nonce 1, zero means none.
 type Transaction struct {
 	Id               [32]byte
+	ChainId          string
 	SenderAddress    string
 	RecipientAddress string
-	Amount           float32
+	Amount           Amount
+	Fee              Amount
+	Nonce            uint64
+	// Inputs and Outputs are only used by the UTXO ledger.
+	Inputs  []Input
+	Outputs []Output
+
+	SenderPublicKey *ecdsa.PublicKey
+	Signature       *utils.Signature
 }
 
-func NewTransaction(senderAddress string, recipientAddress string, value float32) *Transaction {
+func NewTransaction(senderAddress string, recipientAddress string, value Amount) *Transaction {
 	return &Transaction{SenderAddress: senderAddress, RecipientAddress: recipientAddress, Amount: value}
 }
 
@@ -22,49 +49,183 @@ func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 25))
 	fmt.Printf("SenderAddress: %s\n", t.SenderAddress)
 	fmt.Printf("RecipientAddress: %s\n", t.RecipientAddress)
-	fmt.Printf("Amount: %.1f\n", t.Amount)
+	fmt.Printf("Amount: %s\n", t.Amount)
+	fmt.Printf("Fee: %s\n", t.Fee)
+	fmt.Printf("Nonce: %d\n", t.Nonce)
 }
 
-func (t *Transaction) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		Id               string  `json:"id"`
-		SenderAddress    string  `json:"sender_address"`
-		RecipientAddress string  `json:"recipient_address"`
-		Amount           float32 `json:"amount"`
-	}{
-		Id:               t.HexHash(),
+type payload struct {
+	Id               string   `json:"id"`
+	ChainId          string   `json:"chain_id"`
+	SenderAddress    string   `json:"sender_address"`
+	RecipientAddress string   `json:"recipient_address"`
+	Amount           Amount   `json:"amount"`
+	Fee              Amount   `json:"fee"`
+	Nonce            uint64   `json:"nonce"`
+	Inputs           []Input  `json:"inputs,omitempty"`
+	Outputs          []Output `json:"outputs,omitempty"`
+}
+
+func (t *Transaction) payload() payload {
+	return payload{
+		Id:               fmt.Sprintf("%x", t.Id),
+		ChainId:          t.ChainId,
 		SenderAddress:    t.SenderAddress,
 		RecipientAddress: t.RecipientAddress,
 		Amount:           t.Amount,
+		Fee:              t.Fee,
+		Nonce:            t.Nonce,
+		Inputs:           t.Inputs,
+		Outputs:          t.Outputs,
+	}
+}
+
+func (t *Transaction) MarshalJSON() ([]byte, error) {
+	var publicKey, signature string
+	if t.SenderPublicKey != nil {
+		publicKey = utils.PublicKeyToString(t.SenderPublicKey)
+	}
+	if t.Signature != nil {
+		signature = t.Signature.String()
+	}
+	return json.Marshal(struct {
+		payload
+		SenderPublicKey string `json:"sender_public_key,omitempty"`
+		Signature       string `json:"signature,omitempty"`
+	}{
+		payload:         t.payload(),
+		SenderPublicKey: publicKey,
+		Signature:       signature,
 	})
 }
 
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	var v struct {
+		payload
+		SenderPublicKey string `json:"sender_public_key"`
+		Signature       string `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	id, err := hex.DecodeString(v.Id)
+	if err != nil {
+		return fmt.Errorf("invalid transaction id: %w", err)
+	}
+	copy(t.Id[:], id)
+	t.ChainId = v.ChainId
+	t.SenderAddress = v.SenderAddress
+	t.RecipientAddress = v.RecipientAddress
+	t.Amount = v.Amount
+	t.Fee = v.Fee
+	t.Nonce = v.Nonce
+	t.Inputs = v.Inputs
+	t.Outputs = v.Outputs
+	t.SenderPublicKey = nil
+	t.Signature = nil
+	if v.SenderPublicKey != "" {
+		if len(v.SenderPublicKey) != 128 {
+			return fmt.Errorf("invalid sender public key length %d", len(v.SenderPublicKey))
+		}
+		t.SenderPublicKey = utils.PublicKeyFromString(v.SenderPublicKey)
+	}
+	if v.Signature != "" {
+		if len(v.Signature) != 128 {
+			return fmt.Errorf("invalid signature length %d", len(v.Signature))
+		}
+		t.Signature = utils.SignatureFromString(v.Signature)
+	}
+	return nil
+}
+
+// Size returns the encoded size of the transaction in bytes, witness
+// included.
+func (t *Transaction) Size() int {
+	m, err := t.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return len(m)
+}
+
+// FeeRate returns the fee paid per FEE_RATE_BYTES of the transaction.
+func (t *Transaction) FeeRate() Amount {
+	return t.Fee * FEE_RATE_BYTES / Amount(t.Size())
+}
+
 func (t *Transaction) HexHash() string {
 	return fmt.Sprintf("%x", t.Id)
 }
 
+// Hash returns the transaction id, the double SHA-256 of the binary encoding
+// of the payload. Neither the id itself nor the witness (public key and
+// signature) is part of the hash.
 func (t *Transaction) Hash() ([32]byte, error) {
-	m, err := t.MarshalJSON()
+	w := codec.NewWriter()
+	t.encodePayload(w)
+	first := sha256.Sum256(w.Bytes())
+	return sha256.Sum256(first[:]), nil
+}
+
+// SigningHash returns the hash the sender signs, which is the transaction id.
+func (t *Transaction) SigningHash() ([32]byte, error) {
+	return t.Hash()
+}
+
+// VerifySignature checks that the witness signs the transaction id and that
+// the public key belongs to the sender address.
+func (t *Transaction) VerifySignature() error {
+	if t.SenderPublicKey == nil || t.Signature == nil {
+		return fmt.Errorf("missing signature")
+	}
+	if address := utils.AddressFromPublicKey(t.SenderPublicKey); address != t.SenderAddress {
+		return fmt.Errorf("public key belongs to %s, not to sender %s", address, t.SenderAddress)
+	}
+	h, err := t.SigningHash()
 	if err != nil {
-		return [32]byte{}, err
+		return err
 	}
-
-	first := sha256.Sum256(m)
-	second := sha256.Sum256(first[:])
-	return second, nil
+	if !t.Signature.IsLowS(t.SenderPublicKey.Curve) {
+		return fmt.Errorf("signature is not in low-S form")
+	}
+	if !ecdsa.Verify(t.SenderPublicKey, h[:], t.Signature.R, t.Signature.S) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
 }
 
 type Request struct {
-	RecipientAddress string  `json:"recipient_address"`
-	Amount           float32 `json:"amount"`
-	SenderAddress    string  `json:"sender_address"`
-	SenderPublicKey  string  `json:"sender_public_key"`
-	Signature        string  `json:"signature"`
+	ChainId          string   `json:"chain_id"`
+	RecipientAddress string   `json:"recipient_address"`
+	Amount           Amount   `json:"amount"`
+	Fee              Amount   `json:"fee"`
+	Nonce            uint64   `json:"nonce"`
+	SenderAddress    string   `json:"sender_address"`
+	SenderPublicKey  string   `json:"sender_public_key"`
+	Signature        string   `json:"signature"`
+	Inputs           []Input  `json:"inputs,omitempty"`
+	Outputs          []Output `json:"outputs,omitempty"`
 }
 
 func (t *Request) Validate() bool {
-	if t.RecipientAddress == "" || t.SenderAddress == "" || t.SenderPublicKey == "" || t.Signature == "" {
+	if t.ChainId == "" || t.SenderAddress == "" || len(t.SenderPublicKey) != 128 || len(t.Signature) != 128 {
+		return false
+	}
+	if t.RecipientAddress == "" && len(t.Outputs) == 0 {
 		return false
 	}
 	return true
 }
+
+// Transaction returns the signed transaction described by the request.
+func (t *Request) Transaction() *Transaction {
+	tx := NewTransaction(t.SenderAddress, t.RecipientAddress, t.Amount)
+	tx.ChainId = t.ChainId
+	tx.Fee = t.Fee
+	tx.Nonce = t.Nonce
+	tx.Inputs = t.Inputs
+	tx.Outputs = t.Outputs
+	tx.SenderPublicKey = utils.PublicKeyFromString(t.SenderPublicKey)
+	tx.Signature = utils.SignatureFromString(t.Signature)
+	return tx
+}
@@ -0,0 +1,59 @@
+package transaction
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/utils"
+)
+
+func TestVerifySignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(tx *Transaction)
+		valid  bool
+	}{
+		{
+			name:   "valid",
+			modify: func(tx *Transaction) {},
+			valid:  true,
+		},
+		{
+			name: "high S",
+			modify: func(tx *Transaction) {
+				n := elliptic.P256().Params().N
+				tx.Signature = &utils.Signature{R: tx.Signature.R, S: new(big.Int).Sub(n, tx.Signature.S)}
+			},
+		},
+		{
+			name:   "changed amount",
+			modify: func(tx *Transaction) { tx.Amount++ },
+		},
+		{
+			name:   "other sender",
+			modify: func(tx *Transaction) { tx.SenderAddress = signed(t, &Transaction{}).SenderAddress },
+		},
+		{
+			name:   "key of another sender",
+			modify: func(tx *Transaction) { tx.SenderPublicKey = signed(t, &Transaction{}).SenderPublicKey },
+		},
+		{
+			name:   "missing signature",
+			modify: func(tx *Transaction) { tx.Signature = nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := signed(t, &Transaction{ChainId: "test", RecipientAddress: "recipient", Amount: 10, Nonce: 1})
+			tt.modify(tx)
+			err := tx.VerifySignature()
+			if tt.valid && err != nil {
+				t.Fatalf("VerifySignature: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("VerifySignature succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package transaction
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Input references an output of a previous transaction that a UTXO
+// transaction spends.
+type Input struct {
+	TxId  [32]byte
+	Index uint32
+}
+
+// IsNull reports whether the input references no transaction, as the input
+// of a coinbase does.
+func (in Input) IsNull() bool {
+	return in.TxId == [32]byte{}
+}
+
+func (in Input) String() string {
+	return fmt.Sprintf("%x:%d", in.TxId, in.Index)
+}
+
+func (in Input) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxId  string `json:"tx_id"`
+		Index uint32 `json:"index"`
+	}{
+		TxId:  fmt.Sprintf("%x", in.TxId),
+		Index: in.Index,
+	})
+}
+
+func (in *Input) UnmarshalJSON(data []byte) error {
+	var v struct {
+		TxId  string `json:"tx_id"`
+		Index uint32 `json:"index"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	id, err := hex.DecodeString(v.TxId)
+	if err != nil || len(id) != 32 {
+		return fmt.Errorf("invalid input transaction id %q", v.TxId)
+	}
+	copy(in.TxId[:], id)
+	in.Index = v.Index
+	return nil
+}
+
+// Output assigns an amount to an address. In the UTXO ledger it can be spent
+// exactly once by an Input referencing it.
+type Output struct {
+	Address string `json:"address"`
+	Amount  Amount `json:"amount"`
+}
+
+// Outs returns the outputs created by t. A transaction without explicit
+// outputs, such as the coinbase, creates a single output paying Amount to
+// RecipientAddress.
+func (t *Transaction) Outs() []Output {
+	if len(t.Outputs) > 0 {
+		return t.Outputs
+	}
+	return []Output{{Address: t.RecipientAddress, Amount: t.Amount}}
+}
+
+// Value returns the total amount of the outputs created by t.
+func (t *Transaction) Value() Amount {
+	var total Amount
+	for _, out := range t.Outs() {
+		total += out.Amount
+	}
+	return total
+}
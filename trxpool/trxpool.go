@@ -3,61 +3,237 @@ package trxpool
 import (
 	"fmt"
 	"github.com/fr13n8/go-blockchain/transaction"
+	"sort"
 	"sync"
 )
 
+// The pool holds at most MAX_POOL_TRANSACTIONS transactions of MAX_POOL_SIZE
+// bytes in total. Once it is full, a transaction is only added if it pays a
+// higher fee rate than the ones it evicts.
+const (
+	MAX_POOL_TRANSACTIONS = 20_000
+	MAX_POOL_SIZE         = 8_000_000
+)
+
 type TransactionPool struct {
 	pool map[string]*transaction.Transaction
-	l    sync.RWMutex
+	// size is the encoded size of the pooled transactions in bytes.
+	size int
+	// pending is the total amount and fees each sender spends in pooled
+	// transactions.
+	pending map[string]transaction.Amount
+	// spends maps every output spent by a pooled transaction to its spender.
+	spends map[transaction.Input]string
+	// nonces maps the nonce of every pooled transaction to its key, by sender.
+	nonces map[string]map[uint64]string
+	l      sync.RWMutex
 }
 
 func NewTransactionPool() *TransactionPool {
 	return &TransactionPool{
-		pool: make(map[string]*transaction.Transaction, 1024),
+		pool:    make(map[string]*transaction.Transaction, 1024),
+		pending: make(map[string]transaction.Amount),
+		spends:  make(map[transaction.Input]string),
+		nonces:  make(map[string]map[uint64]string),
 	}
 }
 
-func (tp *TransactionPool) Add(tx *transaction.Transaction) {
+// Add pools tx, evicting transactions of a lower fee rate if the pool is
+// full. It reports whether tx was added.
+func (tp *TransactionPool) Add(tx *transaction.Transaction) bool {
 	tp.l.Lock()
-	Id, err := tx.Hash()
+	defer tp.l.Unlock()
+	Id, err := tx.SigningHash()
 	if err != nil {
-		return
+		return false
 	}
 	tx.Id = Id
-	hash, err := tx.Hash()
-	if err != nil {
-		return
+	key := fmt.Sprintf("%x", Id)
+	if _, ok := tp.pool[key]; ok {
+		return false
+	}
+	if _, ok := tp.nonces[tx.SenderAddress][tx.Nonce]; ok && tx.Nonce > 0 {
+		return false
+	}
+	evict, ok := tp.evictions(tx)
+	if !ok {
+		return false
+	}
+	tp.clean(evict)
+
+	tp.pool[key] = tx
+	tp.size += tx.Size()
+	if tx.Nonce > 0 {
+		if tp.nonces[tx.SenderAddress] == nil {
+			tp.nonces[tx.SenderAddress] = make(map[uint64]string)
+		}
+		tp.nonces[tx.SenderAddress][tx.Nonce] = key
 	}
-	tp.pool[fmt.Sprintf("%x", hash)] = tx
-	tp.l.Unlock()
+	tp.pending[tx.SenderAddress] += tx.Amount + tx.Fee
+	for _, in := range tx.Inputs {
+		tp.spends[in] = key
+	}
+	return true
 }
 
-func (tp *TransactionPool) Clean(trxs []*transaction.Transaction) {
+// evictions returns the transactions to drop to make room for tx, those of
+// the lowest fee rate first, and whether there is room for tx once they are
+// dropped. Only transactions of a lower fee rate than tx are dropped, along
+// with the later transactions of their senders, which could not be mined
+// without them. The transactions of the sender of tx are kept.
+func (tp *TransactionPool) evictions(tx *transaction.Transaction) ([]*transaction.Transaction, bool) {
+	count, size := len(tp.pool)+1, tp.size+tx.Size()
+	if count <= MAX_POOL_TRANSACTIONS && size <= MAX_POOL_SIZE {
+		return nil, true
+	}
+
+	candidates := make([]*transaction.Transaction, 0, len(tp.pool))
+	rates := make(map[*transaction.Transaction]transaction.Amount, len(tp.pool))
+	for _, t := range tp.pool {
+		if t.SenderAddress != tx.SenderAddress {
+			candidates = append(candidates, t)
+			rates[t] = t.FeeRate()
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return rates[candidates[i]] < rates[candidates[j]]
+	})
+
+	rate := tx.FeeRate()
+	evicted := make(map[*transaction.Transaction]bool)
+	var evict []*transaction.Transaction
+	for _, t := range candidates {
+		if count <= MAX_POOL_TRANSACTIONS && size <= MAX_POOL_SIZE {
+			break
+		}
+		if evicted[t] {
+			continue
+		}
+		if rates[t] >= rate {
+			return nil, false
+		}
+		for _, d := range tp.withDescendants(t) {
+			if !evicted[d] {
+				evicted[d] = true
+				evict = append(evict, d)
+				count--
+				size -= d.Size()
+			}
+		}
+	}
+	return evict, count <= MAX_POOL_TRANSACTIONS && size <= MAX_POOL_SIZE
+}
+
+// withDescendants returns t and the pooled transactions of its sender with
+// the nonces that follow it.
+func (tp *TransactionPool) withDescendants(t *transaction.Transaction) []*transaction.Transaction {
+	txs := []*transaction.Transaction{t}
+	if t.Nonce == 0 {
+		return txs
+	}
+	for nonce := t.Nonce + 1; ; nonce++ {
+		key, ok := tp.nonces[t.SenderAddress][nonce]
+		if !ok {
+			return txs
+		}
+		txs = append(txs, tp.pool[key])
+	}
+}
+
+// clean drops the given transactions from the pool. It must be called with
+// the pool lock held.
+func (tp *TransactionPool) clean(trxs []*transaction.Transaction) {
 	for _, t := range trxs {
-		h, err := t.Hash()
-		if err != nil {
+		pooled, ok := tp.pool[t.HexHash()]
+		if !ok {
+			continue
+		}
+		delete(tp.pool, t.HexHash())
+		tp.size -= pooled.Size()
+		for _, in := range pooled.Inputs {
+			delete(tp.spends, in)
+		}
+		if pooled.Nonce > 0 {
+			delete(tp.nonces[pooled.SenderAddress], pooled.Nonce)
+			if len(tp.nonces[pooled.SenderAddress]) == 0 {
+				delete(tp.nonces, pooled.SenderAddress)
+			}
+		}
+		if tp.pending[pooled.SenderAddress] <= pooled.Amount+pooled.Fee {
+			delete(tp.pending, pooled.SenderAddress)
 			continue
 		}
-		delete(tp.pool, fmt.Sprintf("%x", h))
+		tp.pending[pooled.SenderAddress] -= pooled.Amount + pooled.Fee
 	}
 }
 
-func (tp *TransactionPool) GetAndClean(n int) []*transaction.Transaction {
-	foundTXs := make([]*transaction.Transaction, 0, n)
+// PendingSpend returns the total amount and fees address spends in pooled
+// transactions.
+func (tp *TransactionPool) PendingSpend(address string) transaction.Amount {
+	tp.l.RLock()
+	defer tp.l.RUnlock()
+	return tp.pending[address]
+}
+
+// IsSpent reports whether a pooled transaction already spends the output
+// referenced by in.
+func (tp *TransactionPool) IsSpent(in transaction.Input) bool {
+	tp.l.RLock()
+	defer tp.l.RUnlock()
+	_, ok := tp.spends[in]
+	return ok
+}
+
+// NextNonce returns the nonce following the pooled transactions of address
+// that continue the sequence starting at next.
+func (tp *TransactionPool) NextNonce(address string, next uint64) uint64 {
+	tp.l.RLock()
+	defer tp.l.RUnlock()
+	for {
+		if _, ok := tp.nonces[address][next]; !ok {
+			return next
+		}
+		next++
+	}
+}
+
+// Remove drops the given transactions from the pool, typically because they
+// were included in a block, together with every pooled transaction that
+// spends one of the same outputs or reuses the same sender nonce and therefore
+// became a double spend.
+func (tp *TransactionPool) Remove(trxs []*transaction.Transaction) {
 	tp.l.Lock()
+	defer tp.l.Unlock()
+	tp.clean(trxs)
 
-	defer func() {
-		tp.Clean(foundTXs)
-		tp.l.Unlock()
-	}()
+	var conflicts []*transaction.Transaction
+	for _, t := range trxs {
+		for _, in := range t.Inputs {
+			if key, ok := tp.spends[in]; ok {
+				conflicts = append(conflicts, tp.pool[key])
+			}
+		}
+		if key, ok := tp.nonces[t.SenderAddress][t.Nonce]; ok && t.Nonce > 0 {
+			conflicts = append(conflicts, tp.pool[key])
+		}
+	}
+	tp.clean(conflicts)
+}
 
+// Drain empties the pool and returns the transactions it held.
+func (tp *TransactionPool) Drain() []*transaction.Transaction {
+	tp.l.Lock()
+	defer tp.l.Unlock()
+	txs := make([]*transaction.Transaction, 0, len(tp.pool))
 	for _, t := range tp.pool {
-		if len(foundTXs) >= n {
-			return foundTXs
-		}
-		foundTXs = append(foundTXs, t)
+		txs = append(txs, t)
 	}
-	return foundTXs
+	tp.pool = make(map[string]*transaction.Transaction, 1024)
+	tp.size = 0
+	tp.pending = make(map[string]transaction.Amount)
+	tp.spends = make(map[transaction.Input]string)
+	tp.nonces = make(map[string]map[uint64]string)
+	return txs
 }
 
 func (tp *TransactionPool) Read(n int) []*transaction.Transaction {
@@ -66,11 +242,16 @@ func (tp *TransactionPool) Read(n int) []*transaction.Transaction {
 
 	txs := make([]*transaction.Transaction, 0, n)
 	for _, t := range tp.pool {
+		if len(txs) >= n {
+			break
+		}
 		txs = append(txs, t)
 	}
 	return txs
 }
 
 func (tp *TransactionPool) Size() int {
+	tp.l.RLock()
+	defer tp.l.RUnlock()
 	return len(tp.pool)
 }
@@ -0,0 +1,116 @@
+package trxpool
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fr13n8/go-blockchain/transaction"
+)
+
+func newTransaction(sender string, nonce uint64, fee transaction.Amount) *transaction.Transaction {
+	return &transaction.Transaction{
+		ChainId:          "test",
+		SenderAddress:    sender,
+		RecipientAddress: "recipient",
+		Amount:           transaction.COIN,
+		Fee:              fee,
+		Nonce:            nonce,
+	}
+}
+
+// fill adds n transactions of distinct senders paying fee.
+func fill(t *testing.T, tp *TransactionPool, n int, fee transaction.Amount) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if !tp.Add(newTransaction(fmt.Sprintf("sender %d", i), 1, fee)) {
+			t.Fatalf("transaction %d was not pooled", i)
+		}
+	}
+}
+
+func TestPoolEviction(t *testing.T) {
+	const fee = transaction.COIN / 100
+	tp := NewTransactionPool()
+	fill(t, tp, MAX_POOL_TRANSACTIONS-3, fee)
+	// the lowest fee rate of the pool, followed by a transaction of the same
+	// sender that cannot be mined without it
+	first, second := newTransaction("low", 1, fee/10), newTransaction("low", 2, 10*fee)
+	own := newTransaction("own", 1, fee/10)
+	for _, tx := range []*transaction.Transaction{first, second, own} {
+		if !tp.Add(tx) {
+			t.Fatal("transaction was not pooled")
+		}
+	}
+
+	if tp.Add(newTransaction("equal", 1, fee/10)) {
+		t.Fatal("transaction of the lowest fee rate was pooled into a full pool")
+	}
+	// the pooled transactions of the sender are never evicted for it
+	if !tp.Add(newTransaction("own", 2, fee/2)) {
+		t.Fatal("transaction of a higher fee rate was not pooled")
+	}
+	if got := tp.Size(); got != MAX_POOL_TRANSACTIONS-1 {
+		t.Fatalf("Size = %d, want %d", got, MAX_POOL_TRANSACTIONS-1)
+	}
+	if got := tp.NextNonce("low", 1); got != 1 {
+		t.Fatalf("NextNonce of the evicted sender = %d, want 1", got)
+	}
+	if got := tp.PendingSpend("low"); got != 0 {
+		t.Fatalf("PendingSpend of the evicted sender = %s, want 0", got)
+	}
+	if got := tp.NextNonce("own", 1); got != 3 {
+		t.Fatalf("NextNonce of the sender = %d, want 3", got)
+	}
+
+	if !tp.Add(newTransaction("last", 1, fee)) {
+		t.Fatal("transaction was not pooled into the free slot")
+	}
+	if tp.Add(newTransaction("rich", 1, fee/20)) {
+		t.Fatal("transaction of the lowest fee rate was pooled into a full pool")
+	}
+	if !tp.Add(newTransaction("rich", 1, fee/5)) {
+		t.Fatal("transaction of a higher fee rate was not pooled")
+	}
+	if got := tp.Size(); got != MAX_POOL_TRANSACTIONS-1 {
+		t.Fatalf("Size = %d, want %d", got, MAX_POOL_TRANSACTIONS-1)
+	}
+	if got := tp.NextNonce("own", 1); got != 1 {
+		t.Fatalf("NextNonce of the evicted sender = %d, want 1", got)
+	}
+}
+
+func TestPoolRemoveConflicts(t *testing.T) {
+	tp := NewTransactionPool()
+	in := transaction.Input{TxId: [32]byte{1}}
+	spend := newTransaction("alice", 0, 1)
+	spend.Inputs = []transaction.Input{in}
+	nonce := newTransaction("bob", 1, 1)
+	other := newTransaction("carol", 1, 1)
+	for _, tx := range []*transaction.Transaction{spend, nonce, other} {
+		if !tp.Add(tx) {
+			t.Fatal("transaction was not pooled")
+		}
+	}
+
+	// mined transactions that conflict with the pooled ones
+	minedSpend := newTransaction("alice", 0, 2)
+	minedSpend.Inputs = []transaction.Input{in}
+	minedNonce := newTransaction("bob", 1, 2)
+	tp.Remove([]*transaction.Transaction{minedSpend, minedNonce})
+
+	if got := tp.Size(); got != 1 {
+		t.Fatalf("Size = %d, want 1", got)
+	}
+	if tp.IsSpent(in) {
+		t.Fatal("input of a removed transaction is still spent")
+	}
+	if got := tp.PendingSpend("bob"); got != 0 {
+		t.Fatalf("PendingSpend = %s, want 0", got)
+	}
+	if txs := tp.Drain(); len(txs) != 1 || txs[0] != other {
+		t.Fatalf("Drain returned %d transactions, want the unrelated one", len(txs))
+	}
+	if tp.Size() != 0 || tp.PendingSpend("carol") != 0 {
+		t.Fatal("pool is not empty after Drain")
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// AddressFromPublicKey derives the blockchain address of a public key.
+func AddressFromPublicKey(publicKey *ecdsa.PublicKey) string {
+	// 1. Perform SHA-256 hashing on the public key (32 bytes)
+	h2 := sha256.New()
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
+	digest2 := h2.Sum(nil)
+	// 2. Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes)
+	h3 := sha256.New()
+	h3.Write(digest2)
+	digest3 := h3.Sum(nil)
+	// 3. Add version byte in front of RIPEMD-160 hash (0x00 for Main Network) (21 bytes)
+	vd4 := make([]byte, 21)
+	vd4[0] = 0x00
+	copy(vd4[1:], digest3[:])
+	// 4. Perform SHA-256 hash on the extended RIPEMD-160 result (32 bytes)
+	h5 := sha256.New()
+	h5.Write(vd4)
+	digest5 := h5.Sum(nil)
+	// 5. Perform SHA-256 hash on the result of the previous SHA-256 hash (32 bytes)
+	h6 := sha256.New()
+	h6.Write(digest5)
+	digest6 := h6.Sum(nil)
+	// 6. Take the first 4 bytes of the second SHA-256 hash. This is the address checksum (4 bytes)
+	checksum := digest6[:4]
+	// 7. Add the 4 checksum bytes from stage 6 at the end of extended RIPEMD-160 hash from stage 3. This is the 25-byte binary Bitcoin Address. (25 bytes)
+	dc8 := make([]byte, 25)
+	copy(dc8[:21], vd4[:])
+	copy(dc8[21:], checksum[:])
+	// 8. Convert the result from a byte string into a base58 string using Base58Check encoding. This is the most commonly used Bitcoin Address format (34 characters)
+	return base58.Encode(dc8)
+}
+
+// ValidateAddress checks that address has the version byte and checksum of
+// the addresses made by AddressFromPublicKey.
+func ValidateAddress(address string) error {
+	b := base58.Decode(address)
+	if len(b) != 25 {
+		return fmt.Errorf("address %q is not 25 base58 encoded bytes", address)
+	}
+	if b[0] != 0x00 {
+		return fmt.Errorf("address %q has unknown version %d", address, b[0])
+	}
+	h := sha256.Sum256(b[:21])
+	h = sha256.Sum256(h[:])
+	if !bytes.Equal(h[:4], b[21:]) {
+		return fmt.Errorf("address %q has a bad checksum", address)
+	}
+	return nil
+}
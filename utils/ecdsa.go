@@ -17,6 +17,21 @@ func (s *Signature) String() string {
 	return fmt.Sprintf("%064x%064x", s.R, s.S)
 }
 
+// IsLowS reports whether S is at most half the order of curve. For every
+// signature (R, S) the signature (R, N-S) is valid as well, so only the low
+// one is accepted to keep others from changing a signature.
+func (s *Signature) IsLowS(curve elliptic.Curve) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.S.Cmp(halfOrder) <= 0
+}
+
+// NormalizeS replaces S with N-S if it is above half the order of curve.
+func (s *Signature) NormalizeS(curve elliptic.Curve) {
+	if !s.IsLowS(curve) {
+		s.S = new(big.Int).Sub(curve.Params().N, s.S)
+	}
+}
+
 func SignatureFromString(s string) *Signature {
 	x, y := String2BigIntTuple(s)
 	return &Signature{
@@ -55,3 +70,7 @@ func PrivateKeyFromString(s string, publicKey *ecdsa.PublicKey) *ecdsa.PrivateKe
 		D:         x,
 	}
 }
+
+func PublicKeyToString(publicKey *ecdsa.PublicKey) string {
+	return fmt.Sprintf("%064x%064x", publicKey.X, publicKey.Y)
+}
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"fmt"
 )
 
 type MerkleTree struct {
@@ -62,3 +64,68 @@ func NewMerkleTree(data [][]byte) *MerkleTree {
 
 	return &tree
 }
+
+// MerkleProof proves that a leaf is part of a merkle tree. Hashes holds the
+// sibling of every node on the path from the leaf up to the root.
+type MerkleProof struct {
+	Index  int
+	Hashes [][]byte
+}
+
+// NewMerkleProof returns the proof for the leaf at index of the tree built
+// by NewMerkleTree from data.
+func NewMerkleProof(data [][]byte, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(data) {
+		return nil, fmt.Errorf("leaf %d out of range of %d leaves", index, len(data))
+	}
+
+	level := make([][]byte, 0, len(data))
+	for _, dat := range data {
+		level = append(level, NewMerkleNode(nil, nil, dat).Data)
+	}
+
+	proof := &MerkleProof{Index: index}
+	for i := index; len(level) > 1; i /= 2 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		proof.Hashes = append(proof.Hashes, level[i^1])
+
+		var next [][]byte
+		for j := 0; j < len(level); j += 2 {
+			next = append(next, merkleParent(level[j], level[j+1]))
+		}
+		level = next
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof reports whether proof shows that data is the leaf at
+// proof.Index of the tree with the given root. A node on the right that
+// equals its sibling is the copy made of the last node of an odd level, not
+// a node of the tree, so a proof through it is rejected: it would show the
+// last leaf at an index past the end.
+func VerifyMerkleProof(root []byte, data []byte, proof *MerkleProof) bool {
+	if proof == nil || proof.Index < 0 {
+		return false
+	}
+	hash := NewMerkleNode(nil, nil, data).Data
+	i := proof.Index
+	for _, sibling := range proof.Hashes {
+		if i%2 == 0 {
+			hash = merkleParent(hash, sibling)
+		} else {
+			if bytes.Equal(sibling, hash) {
+				return false
+			}
+			hash = merkleParent(sibling, hash)
+		}
+		i /= 2
+	}
+	return i == 0 && bytes.Equal(hash, root)
+}
+
+func merkleParent(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+	return hash[:]
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func leaves(n int) [][]byte {
+	data := make([][]byte, n)
+	for i := range data {
+		data[i] = []byte(fmt.Sprintf("leaf %d", i))
+	}
+	return data
+}
+
+func TestMerkleProof(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 9, 16} {
+		data := leaves(n)
+		root := NewMerkleTree(data).RootNode.Data
+		for i := range data {
+			proof, err := NewMerkleProof(data, i)
+			if err != nil {
+				t.Fatalf("%d leaves: proof of leaf %d: %v", n, i, err)
+			}
+			if !VerifyMerkleProof(root, data[i], proof) {
+				t.Fatalf("%d leaves: proof of leaf %d does not verify", n, i)
+			}
+			other := (i + 1) % n
+			if n > 1 && VerifyMerkleProof(root, data[other], proof) {
+				t.Fatalf("%d leaves: proof of leaf %d verifies leaf %d", n, i, other)
+			}
+		}
+	}
+}
+
+func TestMerkleProofRejects(t *testing.T) {
+	data := leaves(5)
+	root := NewMerkleTree(data).RootNode.Data
+	proof, err := NewMerkleProof(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		proof *MerkleProof
+	}{
+		{"nil", nil},
+		{"negative index", &MerkleProof{Index: -1, Hashes: proof.Hashes}},
+		{"other index", &MerkleProof{Index: 3, Hashes: proof.Hashes}},
+		{"index past the tree", &MerkleProof{Index: 2 + 1<<len(proof.Hashes), Hashes: proof.Hashes}},
+		{"missing hash", &MerkleProof{Index: 2, Hashes: proof.Hashes[:len(proof.Hashes)-1]}},
+		{"extra hash", &MerkleProof{Index: 2, Hashes: append(append([][]byte(nil), proof.Hashes...), root)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyMerkleProof(root, data[2], tt.proof) {
+				t.Fatal("proof verifies")
+			}
+		})
+	}
+}
+
+// The last node of an odd level is paired with a copy of itself, so a proof
+// of the last leaf could be replayed at the index of the copy.
+func TestMerkleProofRejectsDuplicatedNode(t *testing.T) {
+	for _, n := range []int{3, 5, 6, 7, 9} {
+		data := leaves(n)
+		root := NewMerkleTree(data).RootNode.Data
+		last := n - 1
+		proof, err := NewMerkleProof(data, last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the copy sits at the odd index next to the node it duplicates, on
+		// the first level where that node is on the left
+		for level := range proof.Hashes {
+			index := last ^ (1 << level)
+			if index <= last || (last>>level)%2 != 0 {
+				continue
+			}
+			forged := &MerkleProof{Index: index, Hashes: proof.Hashes}
+			if VerifyMerkleProof(root, data[last], forged) {
+				t.Fatalf("%d leaves: proof of leaf %d verifies at index %d", n, last, index)
+			}
+		}
+		if _, err := NewMerkleProof(data, n); err == nil {
+			t.Fatalf("%d leaves: proof of leaf %d out of range succeeded", n, n)
+		}
+	}
+}
@@ -3,17 +3,20 @@ package wallet
 import (
 	"context"
 	"embed"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/a-h/templ"
+	"github.com/fr13n8/go-blockchain/blockchain"
 	pb "github.com/fr13n8/go-blockchain/gen/node"
+	"github.com/fr13n8/go-blockchain/spv"
+	"github.com/fr13n8/go-blockchain/transaction"
 	"github.com/fr13n8/go-blockchain/wallet/components"
 	"github.com/fr13n8/go-blockchain/wallet/domain"
 	"google.golang.org/grpc"
@@ -38,6 +41,12 @@ type Config struct {
 	Gateway    string
 	Host       string
 	ServerName string
+	// LightClient makes the wallet verify balances against headers it
+	// validates itself instead of trusting the node.
+	LightClient bool
+	// GenesisHash is the genesis block the light client accepts. If it is
+	// zero the genesis block of the development network is accepted.
+	GenesisHash [32]byte
 }
 
 type Server struct {
@@ -46,6 +55,14 @@ type Server struct {
 	gateway string
 	nc      pb.NodeServiceClient
 	port    uint16
+	// ledger is the ledger model of the node, which decides how
+	// transactions are built.
+	ledger string
+	// chainId is the network transactions are signed for.
+	chainId string
+	// spv is the light client used to verify balances, nil if the node is
+	// trusted.
+	spv *spv.Client
 }
 
 func NewServer(cfg *Config) *Server {
@@ -60,7 +77,15 @@ func NewServer(cfg *Config) *Server {
 		log.Fatalf("[WALLET] Error while pinging gateway: %s", err.Error())
 		return nil
 	}
-	log.Printf("[WALLET] Connected to gateway: %s", pingResponse.Message)
+	log.Printf("[WALLET] Connected to gateway: %s, chain %s, %s ledger", pingResponse.Message, pingResponse.ChainId, pingResponse.Ledger)
+
+	var lightClient *spv.Client
+	if cfg.LightClient {
+		lightClient = spv.NewClient(client, &spv.Config{GenesisHash: cfg.GenesisHash})
+		if err := lightClient.Sync(context.Background()); err != nil {
+			log.Fatalf("[WALLET] Error while syncing headers: %s", err.Error())
+		}
+	}
 
 	return &Server{
 		app: fiber.New(
@@ -72,6 +97,9 @@ func NewServer(cfg *Config) *Server {
 		nc:      client,
 		port:    cfg.Port,
 		host:    cfg.Host,
+		ledger:  pingResponse.Ledger,
+		chainId: pingResponse.ChainId,
+		spv:     lightClient,
 	}
 }
 
@@ -160,8 +188,11 @@ func (s *Server) WalletCreate(ctx *fiber.Ctx) error {
 	return ctx.SendString(string(walletJson[:]))
 }
 
+// TransactionRequest is a transfer submitted by the wallet page. Fee is
+// optional, the node is asked for an estimate if it is empty.
 type TransactionRequest struct {
 	Amount                     string `json:"amount"`
+	Fee                        string `json:"fee"`
 	SenderPrivateKey           string `json:"sender_private_key"`
 	SenderPublicKey            string `json:"sender_public_key"`
 	SenderBlockChainAddress    string `json:"sender_blockchain_address"`
@@ -169,13 +200,18 @@ type TransactionRequest struct {
 }
 
 func (tr *TransactionRequest) Validate() error {
-	amount, err := strconv.ParseFloat(tr.Amount, 64)
+	amount, err := transaction.ParseAmount(tr.Amount)
 	if err != nil {
-		return fmt.Errorf("invalid amount: %s", tr.Amount)
+		return err
 	}
-	if amount <= 0 {
+	if amount == 0 {
 		return fmt.Errorf("amount must be greater than zero")
 	}
+	if tr.Fee != "" {
+		if _, err := transaction.ParseAmount(tr.Fee); err != nil {
+			return err
+		}
+	}
 
 	if tr.SenderPrivateKey == "" {
 		return fmt.Errorf("sender private key is required")
@@ -189,6 +225,14 @@ func (tr *TransactionRequest) Validate() error {
 		return fmt.Errorf("sender blockchain address is required")
 	}
 
+	if len(tr.SenderPublicKey) != 128 {
+		return fmt.Errorf("invalid sender public key")
+	}
+
+	if utils.AddressFromPublicKey(utils.PublicKeyFromString(tr.SenderPublicKey)) != tr.SenderBlockChainAddress {
+		return fmt.Errorf("sender blockchain address does not match the sender public key")
+	}
+
 	if tr.RecipientBlockChainAddress == "" {
 		return fmt.Errorf("recipient blockchain address is required")
 	}
@@ -208,26 +252,78 @@ func (s *Server) CreateTransaction(ctx *fiber.Ctx) error {
 
 	publicKey := utils.PublicKeyFromString(tr.SenderPublicKey)
 	privateKey := utils.PrivateKeyFromString(tr.SenderPrivateKey, publicKey)
-	value, err := strconv.ParseFloat(tr.Amount, 64)
+	amount, err := transaction.ParseAmount(tr.Amount)
 	if err != nil {
 		return err
 	}
-	amount32 := float32(value)
 
-	t := NewTransaction(privateKey, publicKey, tr.SenderBlockChainAddress, tr.RecipientBlockChainAddress, amount32)
-	signature := t.GenerateSignature()
+	var nonce uint64
+	if s.ledger != blockchain.LEDGER_UTXO {
+		resp, err := s.nc.GetNonce(context.Background(), &pb.GetNonceRequest{Address: tr.SenderBlockChainAddress})
+		if err != nil {
+			return ctx.JSON(fiber.Map{
+				"message": err.Error(),
+				"success": false,
+			})
+		}
+		nonce = resp.GetNonce()
+	}
 
-	signatureStr := signature.String()
+	var feeRate *pb.EstimateFeeResponse
+	var fee transaction.Amount
+	if tr.Fee != "" {
+		fee, _ = transaction.ParseAmount(tr.Fee)
+	} else if feeRate, err = s.nc.EstimateFee(context.Background(), &pb.EstimateFeeRequest{}); err != nil {
+		return ctx.JSON(fiber.Map{
+			"message": err.Error(),
+			"success": false,
+		})
+	}
 
-	tx := pb.CreateTransactionRequest{
-		SenderPublicKey:  tr.SenderPublicKey,
-		RecipientAddress: tr.RecipientBlockChainAddress,
-		SenderAddress:    tr.SenderBlockChainAddress,
-		Amount:           amount32,
-		Signature:        signatureStr,
+	var tx *pb.CreateTransactionRequest
+	var t *Transaction
+	// an estimated fee depends on the size of the transaction, which in turn
+	// depends on the fee, so rebuild until the fee covers the size
+	for {
+		tx = &pb.CreateTransactionRequest{
+			ChainId:         s.chainId,
+			SenderPublicKey: tr.SenderPublicKey,
+			SenderAddress:   tr.SenderBlockChainAddress,
+			Fee:             uint64(fee),
+		}
+		if s.ledger == blockchain.LEDGER_UTXO {
+			inputs, outputs, err := s.selectOutputs(tr.SenderBlockChainAddress, tr.RecipientBlockChainAddress, amount, fee)
+			if err != nil {
+				return ctx.JSON(fiber.Map{
+					"message": err.Error(),
+					"success": false,
+				})
+			}
+			t = NewUTXOTransaction(privateKey, publicKey, s.chainId, tr.SenderBlockChainAddress, inputs, outputs, fee)
+			for _, in := range inputs {
+				tx.Inputs = append(tx.Inputs, &pb.TransactionInput{TxId: fmt.Sprintf("%x", in.TxId), Index: in.Index})
+			}
+			for _, out := range outputs {
+				tx.Outputs = append(tx.Outputs, &pb.TransactionOutput{Address: out.Address, Amount: uint64(out.Amount)})
+			}
+		} else {
+			t = NewTransaction(privateKey, publicKey, s.chainId, tr.SenderBlockChainAddress, tr.RecipientBlockChainAddress, amount, fee, nonce)
+			tx.RecipientAddress = tr.RecipientBlockChainAddress
+			tx.Amount = uint64(amount)
+			tx.Nonce = nonce
+		}
+		if feeRate == nil {
+			break
+		}
+		required := (transaction.Amount(feeRate.GetFeeRate())*transaction.Amount(t.Size()) + transaction.Amount(feeRate.GetFeeRateBytes()) - 1) / transaction.Amount(feeRate.GetFeeRateBytes())
+		if required <= fee {
+			break
+		}
+		fee = required
 	}
+	tx.Signature = t.GenerateSignature().String()
 
-	_, err = s.nc.CreateTransaction(context.Background(), &tx)
+	_, err = s.nc.CreateTransaction(context.Background(), tx)
 	if err != nil {
 		return ctx.JSON(fiber.Map{
 			"message": err.Error(),
@@ -242,13 +338,60 @@ func (s *Server) CreateTransaction(ctx *fiber.Ctx) error {
 
 }
 
-func (s *Server) GetBalance(ctx *fiber.Ctx) error {
-	address := ctx.Params("address")
-	addressRequest := pb.GetBalanceRequest{
-		Address: address,
+// selectOutputs picks unspent outputs of sender until they cover amount and
+// fee and returns them as inputs, with an output paying recipient and one
+// returning the change to sender.
+func (s *Server) selectOutputs(sender, recipient string, amount, fee transaction.Amount) ([]transaction.Input, []transaction.Output, error) {
+	resp, err := s.nc.GetUnspentOutputs(context.Background(), &pb.GetUnspentOutputsRequest{Address: sender})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var inputs []transaction.Input
+	var total transaction.Amount
+	for _, u := range resp.GetOutputs() {
+		if total >= amount+fee {
+			break
+		}
+		id, err := hex.DecodeString(u.GetTxId())
+		if err != nil || len(id) != 32 {
+			return nil, nil, fmt.Errorf("invalid unspent output %s", u.GetTxId())
+		}
+		in := transaction.Input{Index: u.GetIndex()}
+		copy(in.TxId[:], id)
+		inputs = append(inputs, in)
+		total += transaction.Amount(u.GetAmount())
+	}
+	if total < amount+fee {
+		return nil, nil, fmt.Errorf("not enough funds: %s available, %s and a fee of %s requested", total, amount, fee)
+	}
+
+	outputs := []transaction.Output{{Address: recipient, Amount: amount}}
+	if change := total - amount - fee; change > 0 {
+		outputs = append(outputs, transaction.Output{Address: sender, Amount: change})
 	}
+	return inputs, outputs, nil
+}
 
-	balance, err := s.nc.GetBalance(context.Background(), &addressRequest)
+// balance returns the balance of address, verified by the light client if
+// it is enabled.
+func (s *Server) balance(address string) (transaction.Amount, error) {
+	if s.spv != nil {
+		if err := s.spv.Sync(context.Background()); err != nil {
+			return 0, err
+		}
+		return s.spv.Balance(context.Background(), address)
+	}
+	balance, err := s.nc.GetBalance(context.Background(), &pb.GetBalanceRequest{Address: address})
+	if err != nil {
+		return 0, err
+	}
+	return transaction.Amount(balance.GetBalance()), nil
+}
+
+func (s *Server) GetBalance(ctx *fiber.Ctx) error {
+	address := ctx.Params("address")
+	balance, err := s.balance(address)
 	if err != nil {
 		return ctx.JSON(fiber.Map{
 			"message": err.Error(),
@@ -259,18 +402,14 @@ func (s *Server) GetBalance(ctx *fiber.Ctx) error {
 	return ctx.JSON(fiber.Map{
 		"message": "Balance retrieved successfully",
 		"success": true,
-		"balance": balance.Balance,
+		"balance": balance.String(),
 	})
 }
 
 func (s *Server) MainView(ctx *fiber.Ctx) error {
 	w := NewWallet()
 	address := w.BlockChainAddress()
-	addressRequest := pb.GetBalanceRequest{
-		Address: address,
-	}
-
-	balance, err := s.nc.GetBalance(context.Background(), &addressRequest)
+	balance, err := s.balance(address)
 	if err != nil {
 		return ctx.JSON(fiber.Map{
 			"message": err.Error(),
@@ -296,7 +435,7 @@ func (s *Server) MainView(ctx *fiber.Ctx) error {
 		},
 		{
 			Field: "Balance",
-			Value: fmt.Sprintf("%.2f", balance.Balance),
+			Value: balance.String(),
 			Id:    "balance",
 		},
 	}
@@ -306,11 +445,7 @@ func (s *Server) MainView(ctx *fiber.Ctx) error {
 
 func (s *Server) GetBalanceView(ctx *fiber.Ctx) error {
 	address := ctx.Params("address")
-	addressRequest := pb.GetBalanceRequest{
-		Address: address,
-	}
-
-	balance, err := s.nc.GetBalance(context.Background(), &addressRequest)
+	balance, err := s.balance(address)
 	if err != nil {
 		return ctx.JSON(fiber.Map{
 			"message": err.Error(),
@@ -318,5 +453,5 @@ func (s *Server) GetBalanceView(ctx *fiber.Ctx) error {
 		})
 	}
 
-	return adaptor.HTTPHandler(templ.Handler(components.WalletDetailsItem("Balance", fmt.Sprintf("%.2f", balance.Balance), "balance")))(ctx)
+	return adaptor.HTTPHandler(templ.Handler(components.WalletDetailsItem("Balance", balance.String(), "balance")))(ctx)
 }
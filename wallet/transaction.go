@@ -3,59 +3,71 @@ package wallet
 import (
 	"crypto/ecdsa"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/json"
 	"fmt"
+	"github.com/fr13n8/go-blockchain/transaction"
 	"github.com/fr13n8/go-blockchain/utils"
 	"log"
 )
 
+// Transaction is a transaction being built and signed by the wallet. It is
+// hashed with the node's canonical encoding, so that both sides agree on the
+// signed bytes.
 type Transaction struct {
 	senderPrivateKey *ecdsa.PrivateKey
-	senderPublicKey  *ecdsa.PublicKey
-	senderAddress    string
-	recipientAddress string
-	amount           float32
-	Id               [32]byte
+	tx               *transaction.Transaction
 }
 
-func NewTransaction(senderPrivateKey *ecdsa.PrivateKey, senderPublicKey *ecdsa.PublicKey, senderAddress string, recipientAddress string, amount float32) *Transaction {
+func NewTransaction(senderPrivateKey *ecdsa.PrivateKey, senderPublicKey *ecdsa.PublicKey, chainId string, senderAddress string, recipientAddress string, amount transaction.Amount, fee transaction.Amount, nonce uint64) *Transaction {
 	return &Transaction{
 		senderPrivateKey: senderPrivateKey,
-		senderPublicKey:  senderPublicKey,
-		senderAddress:    senderAddress,
-		recipientAddress: recipientAddress,
-		amount:           amount,
+		tx: &transaction.Transaction{
+			ChainId:          chainId,
+			SenderAddress:    senderAddress,
+			RecipientAddress: recipientAddress,
+			Amount:           amount,
+			Fee:              fee,
+			Nonce:            nonce,
+			SenderPublicKey:  senderPublicKey,
+		},
+	}
+}
+
+// NewUTXOTransaction creates a transaction for the UTXO ledger that spends
+// inputs owned by senderAddress and creates outputs, leaving fee to the miner.
+func NewUTXOTransaction(senderPrivateKey *ecdsa.PrivateKey, senderPublicKey *ecdsa.PublicKey, chainId string, senderAddress string, inputs []transaction.Input, outputs []transaction.Output, fee transaction.Amount) *Transaction {
+	return &Transaction{
+		senderPrivateKey: senderPrivateKey,
+		tx: &transaction.Transaction{
+			ChainId:         chainId,
+			SenderAddress:   senderAddress,
+			Fee:             fee,
+			Inputs:          inputs,
+			Outputs:         outputs,
+			SenderPublicKey: senderPublicKey,
+		},
 	}
 }
 
 func (t *Transaction) MarshalJSON() ([]byte, error) {
-	return json.Marshal(struct {
-		Id               string  `json:"id"`
-		SenderAddress    string  `json:"sender_address"`
-		RecipientAddress string  `json:"recipient_address"`
-		Amount           float32 `json:"amount"`
-	}{
-		Id:               fmt.Sprintf("%x", t.Id),
-		SenderAddress:    t.senderAddress,
-		RecipientAddress: t.recipientAddress,
-		Amount:           t.amount,
-	})
+	return t.tx.MarshalJSON()
 }
 
-func (t *Transaction) HexHash() string {
-	return fmt.Sprintf("%x", t.Id)
+// Size returns the size of the transaction once signed, which fees are
+// charged for.
+func (t *Transaction) Size() int {
+	return t.tx.Size() + transaction.SIGNATURE_SIZE
 }
 
-func (t *Transaction) Hash() ([32]byte, error) {
-	m, err := t.MarshalJSON()
+func (t *Transaction) HexHash() string {
+	h, err := t.Hash()
 	if err != nil {
-		return [32]byte{}, err
+		log.Fatal(err)
 	}
+	return fmt.Sprintf("%x", h)
+}
 
-	first := sha256.Sum256(m)
-	second := sha256.Sum256(first[:])
-	return second, nil
+func (t *Transaction) Hash() ([32]byte, error) {
+	return t.tx.SigningHash()
 }
 
 func (t *Transaction) GenerateSignature() *utils.Signature {
@@ -68,8 +80,10 @@ func (t *Transaction) GenerateSignature() *utils.Signature {
 	if err != nil {
 		panic(err)
 	}
-	return &utils.Signature{
+	sig := &utils.Signature{
 		R: r,
 		S: s,
 	}
+	sig.NormalizeS(t.senderPrivateKey.Curve)
+	return sig
 }
@@ -4,11 +4,10 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 
-	"github.com/btcsuite/btcutil/base58"
+	"github.com/fr13n8/go-blockchain/utils"
 )
 
 type Wallet struct {
@@ -24,35 +23,8 @@ func NewWallet() *Wallet {
 		panic(err)
 	}
 	publicKey := &privateKey.PublicKey
-	// 2. Perform SHA-256 hashing on the public key (32 bytes)
-	h2 := sha256.New()
-	h2.Write(publicKey.X.Bytes())
-	h2.Write(publicKey.Y.Bytes())
-	digest2 := h2.Sum(nil)
-	// 3. Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes)
-	h3 := sha256.New()
-	h3.Write(digest2)
-	digest3 := h3.Sum(nil)
-	// 4. Add version byte in front of RIPEMD-160 hash (0x00 for Main Network) (21 bytes)
-	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
-	copy(vd4[1:], digest3[:])
-	// 5. Perform SHA-256 hash on the extended RIPEMD-160 result (32 bytes)
-	h5 := sha256.New()
-	h5.Write(vd4)
-	digest5 := h5.Sum(nil)
-	// 6. Perform SHA-256 hash on the result of the previous SHA-256 hash (32 bytes)
-	h6 := sha256.New()
-	h6.Write(digest5)
-	digest6 := h6.Sum(nil)
-	// 7. Take the first 4 bytes of the second SHA-256 hash. This is the address checksum (4 bytes)
-	checksum := digest6[:4]
-	// 8. Add the 4 checksum bytes from stage 7 at the end of extended RIPEMD-160 hash from stage 4. This is the 25-byte binary Bitcoin Address. (25 bytes)
-	dc8 := make([]byte, 25)
-	copy(dc8[:21], vd4[:])
-	copy(dc8[21:], checksum[:])
-	// 9. Convert the result from a byte string into a base58 string using Base58Check encoding. This is the most commonly used Bitcoin Address format (34 characters)
-	address := base58.Encode(dc8)
+	// 2. Deriving the blockchain address from the public key
+	address := utils.AddressFromPublicKey(publicKey)
 
 	return &Wallet{
 		privateKey: privateKey,